@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -14,6 +15,11 @@ type ClusterScanSpec struct {
 	// Target is what to scan (e.g., nginx:1.19, python:3.4-alpine). Used for image scanning tools like Trivy.
 	Target string `json:"target,omitempty"`
 
+	// +kubebuilder:validation:Optional
+	// TargetSelector scans every unique image running in the selected workloads instead of a single Target.
+	// One scan Job is created per image; custom commands can reference the image as $(SCAN_TARGET).
+	TargetSelector *TargetSelector `json:"targetSelector,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// Command allows overriding the entrypoint. If empty and Target is specified, defaults to Trivy image scan.
 	Command []string `json:"command,omitempty"`
@@ -25,6 +31,247 @@ type ClusterScanSpec struct {
 	// +kubebuilder:default=false
 	// Suspend allows pausing the schedule
 	Suspend bool `json:"suspend,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// HistoryLimit controls how many finished runs, and their results, are retained
+	HistoryLimit *HistoryLimit `json:"historyLimit,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// FailurePolicy sets the findings a completed scan may report before it counts as a policy violation
+	FailurePolicy *FailurePolicy `json:"failurePolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Timeout bounds how long a scan run may take, including pulling images and retries. Runs
+	// still going after it are stopped and reported as TimedOut. Defaults to 1h.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// MaxRetries is how many times a failed scanner is retried before the run fails. Defaults to 3.
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// TTLSecondsAfterFinished is how long a finished scan Job and its Pods are kept after the
+	// run is recorded. Defaults to the manager's --job-ttl-seconds-after-finished; unset there,
+	// finished Jobs are kept.
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=code
+	// ExitCodes assigns results to scanner exit codes. Exit code 0 is Clean, or FindingsDetected
+	// when findings were parsed; the --exit-code of Trivy and kube-bench, and exit code 1 of Grype
+	// run with --fail-on, mean FindingsDetected; other exit codes are ScannerError. Only
+	// ScannerError exit codes are retried.
+	ExitCodes []ExitCodeRule `json:"exitCodes,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Resources sets the scanner container's resource requests and limits
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Env sets environment variables in the scanner container (e.g., TRIVY_SEVERITY, HTTPS_PROXY)
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// EnvFrom populates the scanner container's environment from ConfigMaps or Secrets,
+	// e.g. registry credentials
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Volumes are added to the scan Pod, e.g. a PersistentVolumeClaim holding the scanner's cache
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// VolumeMounts mounts Volumes into the scanner container
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ServiceAccountName is the ServiceAccount the scan Pod runs as
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// NodeSelector restricts the nodes the scan Pod is scheduled on
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Tolerations allow the scan Pod onto tainted nodes
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Affinity sets node and pod affinity rules for the scan Pod
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ImagePullSecrets are used to pull the scanner image from a private registry
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// TargetCredentials lets the scanner pull the scanned images from a private registry
+	TargetCredentials *TargetCredentials `json:"targetCredentials,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// HostAccess grants node-level scanners the host namespaces and mounts they inspect
+	HostAccess *HostAccess `json:"hostAccess,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// PerNode runs the scan once on every matching Ready node, one Job per node, for node-level
+	// scanners. Results are reported per node in status.nodes.
+	PerNode *PerNode `json:"perNode,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Sidecars run alongside the scanner in the scan Pod. The scanner and every sidecar mount a
+	// shared emptyDir at /scan-results, e.g. for a sidecar that converts or uploads the output.
+	Sidecars []corev1.Container `json:"sidecars,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ResultsContainer names the container whose logs hold the scan output. It defaults to the
+	// scanner; set it to a sidecar that prints results written to /scan-results.
+	ResultsContainer string `json:"resultsContainer,omitempty"`
+}
+
+// Run results, classifying what a scan run's exit code and findings mean
+const (
+	ResultClean            = "Clean"
+	ResultFindingsDetected = "FindingsDetected"
+	ResultScannerError     = "ScannerError"
+)
+
+// ExitCodeRule assigns a result to a scanner exit code
+type ExitCodeRule struct {
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=255
+	Code int32 `json:"code"`
+
+	// +kubebuilder:validation:Enum=Clean;FindingsDetected;ScannerError
+	// Result is what the exit code means. Clean runs that report findings are still FindingsDetected.
+	Result string `json:"result"`
+}
+
+// PerNode selects the nodes a fanned-out scan runs on
+type PerNode struct {
+	// NodeSelector selects nodes by label. Empty selects every node.
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+}
+
+// Host access profiles
+const (
+	HostAccessKubeBench = "KubeBench"
+)
+
+// HostAccess configures a kube-bench scan Pod that inspects the node it runs on; other scanner
+// images are rejected. The KubeBench profile shares the host PID namespace and mounts
+// /etc/kubernetes, /var/lib/kubelet and /etc/systemd read-only, as kube-bench expects. The Pod tolerates every taint so it can run on control
+// plane nodes; its namespace must allow privileged Pods.
+type HostAccess struct {
+	// +kubebuilder:default=KubeBench
+	// +kubebuilder:validation:Enum=KubeBench
+	// Profile selects the host access to grant
+	Profile string `json:"profile,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// NodeName pins the scan Pod to one node, e.g. a control plane node for kube-bench's master checks
+	NodeName string `json:"nodeName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// AllNodes runs one scan Pod on every Ready node instead of a single Pod, like a DaemonSet.
+	// It is shorthand for an empty PerNode. Results are reported per node in status.nodes.
+	AllNodes bool `json:"allNodes,omitempty"`
+}
+
+// Registry credential formats accepted by TargetCredentials
+const (
+	CredentialsDockerConfigJSON = "DockerConfigJSON"
+	CredentialsBasicAuth        = "BasicAuth"
+)
+
+// TargetCredentials references a Secret in the ClusterScan's namespace holding registry credentials.
+// They are exposed to the scanner in the form it reads: a Docker config file through DOCKER_CONFIG,
+// or username and password variables such as TRIVY_USERNAME and TRIVY_PASSWORD.
+type TargetCredentials struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// SecretName is the Secret holding the credentials
+	SecretName string `json:"secretName"`
+
+	// +kubebuilder:default=DockerConfigJSON
+	// +kubebuilder:validation:Enum=DockerConfigJSON;BasicAuth
+	// Type is the format of the Secret: DockerConfigJSON for a kubernetes.io/dockerconfigjson Secret
+	// (key .dockerconfigjson), BasicAuth for a kubernetes.io/basic-auth Secret (keys username and password)
+	Type string `json:"type,omitempty"`
+}
+
+// FailurePolicy holds per-severity thresholds evaluated against parsed findings.
+// A threshold of 0 fails on any finding of that severity; unset thresholds are not checked.
+type FailurePolicy struct {
+	// +kubebuilder:validation:Minimum=0
+	// MaxCritical is the number of CRITICAL findings tolerated
+	MaxCritical *int32 `json:"maxCritical,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// MaxHigh is the number of HIGH findings tolerated
+	MaxHigh *int32 `json:"maxHigh,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// MaxMedium is the number of MEDIUM findings tolerated
+	MaxMedium *int32 `json:"maxMedium,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// MaxLow is the number of LOW findings tolerated
+	MaxLow *int32 `json:"maxLow,omitempty"`
+
+	// +kubebuilder:default=false
+	// IgnoreUnfixed leaves findings without a fixed version out of the thresholds
+	IgnoreUnfixed bool `json:"ignoreUnfixed,omitempty"`
+}
+
+// Workload kinds a TargetSelector can discover images from
+const (
+	WorkloadPod         = "Pod"
+	WorkloadDeployment  = "Deployment"
+	WorkloadStatefulSet = "StatefulSet"
+	WorkloadDaemonSet   = "DaemonSet"
+)
+
+// TargetSelector selects the running workloads whose images are scanned
+type TargetSelector struct {
+	// Namespaces to discover workloads in. Empty means every namespace.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// LabelSelector filters the workloads by label
+	// +optional
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+
+	// Kinds limits discovery to these workload kinds. Empty means all of them.
+	// +optional
+	// +kubebuilder:validation:items:Enum=Pod;Deployment;StatefulSet;DaemonSet
+	Kinds []string `json:"kinds,omitempty"`
+
+	// +kubebuilder:default=5
+	// +kubebuilder:validation:Minimum=1
+	// MaxConcurrentScans bounds how many image scans run at once
+	MaxConcurrentScans *int32 `json:"maxConcurrentScans,omitempty"`
+
+	// Watch keeps discovering images after the first pass. When a selected workload starts
+	// running an image or digest that has not been scanned, a scan of it is started.
+	// +optional
+	Watch bool `json:"watch,omitempty"`
+}
+
+// HistoryLimit bounds the number of retained runs by outcome
+type HistoryLimit struct {
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=0
+	// Successful is the number of successful runs to keep
+	Successful *int32 `json:"successful,omitempty"`
+
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=0
+	// Failed is the number of failed runs to keep
+	Failed *int32 `json:"failed,omitempty"`
 }
 
 // ClusterScanStatus defines the observed state of ClusterScan
@@ -38,25 +285,212 @@ type ClusterScanStatus struct {
 	// LastJobName records the name of the most recent job created
 	LastJobName string `json:"lastJobName,omitempty"`
 
+	// ObservedGeneration is the most recent ClusterScan generation the controller acted on
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// SpecHash is the hash of the Job spec a one-off scan last ran with, so spec changes are
+	// still detected once its Job has been deleted
+	// +optional
+	SpecHash string `json:"specHash,omitempty"`
+
+	// LastRunNowToken is the value of the run-now annotation that most recently started a run
+	// +optional
+	LastRunNowToken string `json:"lastRunNowToken,omitempty"`
+
 	// Phase represents the high-level status of the scan (e.g., Pending, Running, Done, Scheduled)
 	// +kubebuilder:default="Pending"
 	Phase string `json:"phase,omitempty"`
 
-	// ResultsConfigMap points to the ConfigMap containing full scan results
+	// LatestReport names the ScanReport produced by the most recent completed run
+	// +optional
+	LatestReport string `json:"latestReport,omitempty"`
+
+	// RawOutput locates the unparsed output of the most recent completed run
 	// +optional
-	ResultsConfigMap string `json:"resultsConfigMap,omitempty"`
+	RawOutput *StoredResult `json:"rawOutput,omitempty"`
 
-	// ScanExitCode stores the scanner's exit code (0 = success, non-zero = issues found)
+	// ScanExitCode stores the scanner's exit code; see ScanResult for what it means.
+	// It is unset when the exit code could not be determined.
 	// +optional
 	ScanExitCode *int32 `json:"scanExitCode,omitempty"`
+
+	// ScanResult classifies the most recent run as Clean, FindingsDetected or ScannerError
+	// +optional
+	ScanResult string `json:"scanResult,omitempty"`
+
+	// Summary holds per-severity vulnerability counts parsed from the scanner's JSON output
+	// +optional
+	Summary *VulnerabilitySummary `json:"summary,omitempty"`
+
+	// History lists the most recent finished runs, newest first
+	// +optional
+	History []ScanRun `json:"history,omitempty"`
+
+	// Targets reports the per-image results of a TargetSelector scan. Summary then aggregates every target.
+	// +optional
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// Nodes reports the per-node results of a scan fanned out to every node. Summary then aggregates every node.
+	// +optional
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+
+	// FailedNodes lists the nodes whose scan failed in a fanned-out scan
+	// +optional
+	FailedNodes []string `json:"failedNodes,omitempty"`
+}
+
+// NodeStatus is the scan state of one node of a fanned-out scan
+type NodeStatus struct {
+	// Name is the node the scan Pod ran on
+	Name string `json:"name"`
+
+	// Phase is Pending, Running, Completed, PolicyViolated or Failed
+	Phase string `json:"phase"`
+
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// Report names the ScanReport for this node
+	// +optional
+	Report string `json:"report,omitempty"`
+
+	// +optional
+	Summary *VulnerabilitySummary `json:"summary,omitempty"`
+}
+
+// TargetStatus is the scan state of one image discovered by a TargetSelector
+type TargetStatus struct {
+	// Image is the image reference as used by the workloads
+	Image string `json:"image"`
+
+	// Digest is the digest the image resolved to in a running Pod, when known
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// Phase is Pending, Running, Completed, PolicyViolated or Failed
+	Phase string `json:"phase"`
+
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// Report names the ScanReport for this image
+	// +optional
+	Report string `json:"report,omitempty"`
+
+	// +optional
+	Summary *VulnerabilitySummary `json:"summary,omitempty"`
+
+	// CachedFrom is set when the image's results were reused from another report rather than scanned
+	// +optional
+	CachedFrom string `json:"cachedFrom,omitempty"`
+}
+
+// ScanRun records the outcome of a single finished scan Job
+type ScanRun struct {
+	// JobName is the Job that ran the scan. Runs that reused a cached result never create it.
+	JobName string `json:"jobName"`
+
+	// Outcome is Succeeded, Failed or TimedOut
+	Outcome string `json:"outcome"`
+
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Report names the ScanReport produced by the run, if any
+	// +optional
+	Report string `json:"report,omitempty"`
+
+	// +optional
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// Result classifies the run as Clean, FindingsDetected or ScannerError
+	// +optional
+	Result string `json:"result,omitempty"`
+
+	// PolicyViolated is set when the run's findings exceeded the failure policy
+	// +optional
+	PolicyViolated bool `json:"policyViolated,omitempty"`
+
+	// CachedFrom is set when the run reused a fresh result for the same image digest, scanner
+	// and database from the named namespace/report instead of running a Job
+	// +optional
+	CachedFrom string `json:"cachedFrom,omitempty"`
+
+	// Reason explains why an unsuccessful run ended, e.g. DeadlineExceeded or BackoffLimitExceeded
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Attempts counts the times the scanner ran for the Job: one per Pod plus each restart of
+	// its scanner container
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Failure describes why an unsuccessful run failed, as seen on its newest Pod
+	// +optional
+	Failure *FailureDiagnostics `json:"failure,omitempty"`
+}
+
+// FailureDiagnostics is captured from a failed run's Pod when the failure is recorded, since the
+// Pod may be gone by the time someone looks into it
+type FailureDiagnostics struct {
+	// Pod is the scan Pod the diagnostics were taken from
+	// +optional
+	Pod string `json:"pod,omitempty"`
+
+	// Container is the container that failed, unset when the Pod itself failed
+	// +optional
+	Container string `json:"container,omitempty"`
+
+	// Reason is the container's termination or waiting reason, e.g. OOMKilled, Error,
+	// ImagePullBackOff or CreateContainerConfigError, or the Pod's reason
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// +optional
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LogTail holds the last lines the failed container logged
+	// +optional
+	LogTail string `json:"logTail,omitempty"`
+}
+
+// VulnerabilitySummary aggregates the findings of a scan by severity
+type VulnerabilitySummary struct {
+	Critical int32 `json:"critical"`
+	High     int32 `json:"high"`
+	Medium   int32 `json:"medium"`
+	Low      int32 `json:"low"`
+	Unknown  int32 `json:"unknown"`
+
+	// Fixable counts findings for which a fixed version is available
+	Fixable int32 `json:"fixable"`
+
+	// TopCVEs lists the most severe vulnerability IDs found, highest severity first
+	// +optional
+	TopCVEs []string `json:"topCVEs,omitempty"`
+
+	// Suppressed counts findings accepted by a ScanException or ClusterScanException.
+	// They are excluded from every other count.
+	// +optional
+	Suppressed int32 `json:"suppressed,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 // +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.target`
-// +kubebuilder:printcolumn:name="Results",type=string,JSONPath=`.status.resultsConfigMap`
+// +kubebuilder:printcolumn:name="Report",type=string,JSONPath=`.status.latestReport`
 // +kubebuilder:printcolumn:name="Exit Code",type=integer,JSONPath=`.status.scanExitCode`
+// +kubebuilder:printcolumn:name="Result",type=string,JSONPath=`.status.scanResult`
+// +kubebuilder:printcolumn:name="Critical",type=integer,JSONPath=`.status.summary.critical`
+// +kubebuilder:printcolumn:name="High",type=integer,JSONPath=`.status.summary.high`
 // +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
 // +kubebuilder:printcolumn:name="Last Run",type=date,JSONPath=`.status.lastRunTime`
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
@@ -0,0 +1,96 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ScanExceptionSpec accepts findings matching every populated criterion. Within a list,
+// any entry may match. Image and package patterns support * wildcards.
+// +kubebuilder:validation:XValidation:rule="has(self.vulnerabilityIDs) || has(self.packages)",message="at least one of vulnerabilityIDs or packages is required"
+type ScanExceptionSpec struct {
+	// VulnerabilityIDs are the CVE, GHSA or check IDs being accepted
+	// +optional
+	VulnerabilityIDs []string `json:"vulnerabilityIDs,omitempty"`
+
+	// Packages limits the exception to findings in these packages (e.g., openssl, lib*)
+	// +optional
+	Packages []string `json:"packages,omitempty"`
+
+	// Targets limits the exception to scans of matching images (e.g., docker.io/library/nginx:*)
+	// +optional
+	Targets []string `json:"targets,omitempty"`
+
+	// ScannerTypes limits the exception to these scanners (trivy, grype, kube-bench, kubesec)
+	// +optional
+	ScannerTypes []string `json:"scannerTypes,omitempty"`
+
+	// +kubebuilder:validation:MinLength=1
+	// Justification records why the findings are accepted
+	Justification string `json:"justification"`
+
+	// ExpiresAt is when the exception stops applying. Omit for a permanent exception.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// ScanExceptionStatus defines the observed state of an exception
+type ScanExceptionStatus struct {
+	// Expired is set once ExpiresAt has passed
+	// +optional
+	Expired bool `json:"expired,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.spec.expiresAt`
+// +kubebuilder:printcolumn:name="Expired",type=boolean,JSONPath=`.status.expired`
+// +kubebuilder:printcolumn:name="Justification",type=string,JSONPath=`.spec.justification`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ScanException accepts findings for ClusterScans in its namespace
+type ScanException struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScanExceptionSpec   `json:"spec"`
+	Status ScanExceptionStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ScanExceptionList contains a list of ScanException
+type ScanExceptionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScanException `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.spec.expiresAt`
+// +kubebuilder:printcolumn:name="Expired",type=boolean,JSONPath=`.status.expired`
+// +kubebuilder:printcolumn:name="Justification",type=string,JSONPath=`.spec.justification`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterScanException accepts findings for ClusterScans in every namespace
+type ClusterScanException struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScanExceptionSpec   `json:"spec"`
+	Status ScanExceptionStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterScanExceptionList contains a list of ClusterScanException
+type ClusterScanExceptionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterScanException `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ScanException{}, &ScanExceptionList{}, &ClusterScanException{}, &ClusterScanExceptionList{})
+}
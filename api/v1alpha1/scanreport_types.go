@@ -0,0 +1,158 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ScanReportSpec holds the normalized results of a single completed scan run
+type ScanReportSpec struct {
+	// ScanName is the ClusterScan that produced this report
+	ScanName string `json:"scanName"`
+
+	// JobName is the Job that ran the scanner
+	JobName string `json:"jobName"`
+
+	// Scanner describes the tool that produced the findings
+	Scanner ScannerInfo `json:"scanner"`
+
+	// Target is what was scanned (e.g., nginx:1.19). Empty for cluster or node level scanners.
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// TargetDigest is the resolved digest of the scanned image, when the scanner reports one
+	// +optional
+	TargetDigest string `json:"targetDigest,omitempty"`
+
+	// NodeName is the node a node-level scan inspected, when the scan Pod was pinned to one
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+
+	// StartTime is when the scan Job started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the scan Job finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// ExitCode is the scanner container's exit code
+	// +optional
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// Result classifies the run as Clean, FindingsDetected or ScannerError
+	// +optional
+	Result string `json:"result,omitempty"`
+
+	// RawOutput locates the unparsed scanner output in the configured result store
+	// +optional
+	RawOutput *StoredResult `json:"rawOutput,omitempty"`
+
+	// Summary aggregates all findings by severity
+	Summary VulnerabilitySummary `json:"summary"`
+
+	// Findings lists the normalized findings, most severe first
+	// +optional
+	Findings []Finding `json:"findings,omitempty"`
+
+	// FindingsTruncated is set when only the most severe findings could be stored
+	// +optional
+	FindingsTruncated bool `json:"findingsTruncated,omitempty"`
+
+	// AppliedExceptions names the exceptions that suppressed findings, as Kind/[namespace/]name
+	// +optional
+	AppliedExceptions []string `json:"appliedExceptions,omitempty"`
+
+	// PolicyViolations lists the failure policy thresholds the findings exceeded
+	// +optional
+	PolicyViolations []string `json:"policyViolations,omitempty"`
+
+	// CachedFrom is the namespace/name of the report whose scanner output was reused for this
+	// run instead of launching a Job. Timestamps, digest and exit code are those of that report.
+	// +optional
+	CachedFrom string `json:"cachedFrom,omitempty"`
+}
+
+// StoredResult locates raw scanner output held in a result store
+type StoredResult struct {
+	// URI identifies the stored object, e.g. configmap://default/scan-job-results,
+	// file:///var/lib/clusterscan/results/default/scan-job.txt or s3://bucket/default/scan-job.txt
+	URI string `json:"uri"`
+
+	// Checksum is the SHA-256 digest of the stored output, in the form sha256:<hex>
+	Checksum string `json:"checksum"`
+
+	// Size is the length of the stored output in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+}
+
+// ScannerInfo identifies the scanner that produced a report
+type ScannerInfo struct {
+	// Type is the scanner family (trivy, grype, kube-bench, kubesec or unknown)
+	Type string `json:"type"`
+
+	// Image is the scanner container image
+	Image string `json:"image"`
+
+	// DBVersion identifies the vulnerability database used, when the scanner reports it. Grype
+	// reports its database build time; Trivy's JSON output has no database metadata, so it is
+	// empty for Trivy and cached Trivy results are reused until the result cache TTL expires.
+	// +optional
+	DBVersion string `json:"dbVersion,omitempty"`
+}
+
+// Finding is a single issue reported by a scanner, normalized across scanner types
+type Finding struct {
+	// ID is the vulnerability ID (CVE, GHSA), benchmark check number or rule ID
+	ID string `json:"id"`
+
+	// Severity is one of CRITICAL, HIGH, MEDIUM, LOW or UNKNOWN
+	Severity string `json:"severity"`
+
+	// +optional
+	Title string `json:"title,omitempty"`
+
+	// Target is what the finding applies to: an image layer, a Kubernetes object or a node component
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// +optional
+	Package string `json:"package,omitempty"`
+
+	// +optional
+	InstalledVersion string `json:"installedVersion,omitempty"`
+
+	// FixedVersion is the first version that resolves the finding, if any
+	// +optional
+	FixedVersion string `json:"fixedVersion,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Scan",type=string,JSONPath=`.spec.scanName`
+// +kubebuilder:printcolumn:name="Scanner",type=string,JSONPath=`.spec.scanner.type`
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.target`
+// +kubebuilder:printcolumn:name="Critical",type=integer,JSONPath=`.spec.summary.critical`
+// +kubebuilder:printcolumn:name="High",type=integer,JSONPath=`.spec.summary.high`
+// +kubebuilder:printcolumn:name="Completed",type=date,JSONPath=`.spec.completionTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ScanReport is the Schema for the scanreports API
+type ScanReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ScanReportSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ScanReportList contains a list of ScanReport
+type ScanReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScanReport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ScanReport{}, &ScanReportList{})
+}
@@ -0,0 +1,227 @@
+// Command export-results writes the raw output of ClusterScans to local files. It reads the
+// output through the result store, so compressed and chunked ConfigMaps are reassembled.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(scanv1alpha1.AddToScheme(scheme))
+}
+
+type exporter struct {
+	client    client.Client
+	namespace string
+	dir       string
+	s3        resultstore.S3Config
+}
+
+func main() {
+	var namespace, dir string
+	var all bool
+	var s3Config resultstore.S3Config
+	flag.StringVar(&namespace, "namespace", "", "Namespace of the ClusterScans (default: the kubeconfig's current namespace).")
+	flag.StringVar(&dir, "dir", "./scan-results", "Directory results are written to.")
+	flag.BoolVar(&all, "all", false, "Export every ClusterScan in the namespace.")
+	flag.StringVar(&s3Config.Endpoint, "s3-endpoint", "", "S3-compatible endpoint for results stored with --result-store=s3.")
+	flag.StringVar(&s3Config.Region, "s3-region", "", "The bucket region.")
+	flag.BoolVar(&s3Config.Insecure, "s3-insecure", false, "If set, the S3 endpoint is accessed over plain HTTP.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <scan-name>... | --all\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if !all && flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if namespace == "" {
+		current, _, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).Namespace()
+		if err != nil {
+			fail("unable to determine namespace: %v", err)
+		}
+		namespace = current
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		fail("unable to create client: %v", err)
+	}
+	e := &exporter{client: c, namespace: namespace, dir: dir, s3: s3Config}
+
+	ctx := context.Background()
+	names := flag.Args()
+	if all {
+		scans := &scanv1alpha1.ClusterScanList{}
+		if err := c.List(ctx, scans, client.InNamespace(namespace)); err != nil {
+			fail("unable to list ClusterScans: %v", err)
+		}
+		names = nil
+		for _, scan := range scans.Items {
+			names = append(names, scan.Name)
+		}
+	}
+
+	failed := false
+	for _, name := range names {
+		if err := e.export(ctx, name); err != nil {
+			fmt.Printf("[ERROR] %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	// A batch export skips scans without results rather than failing
+	if failed && !all {
+		os.Exit(1)
+	}
+}
+
+// export writes the latest raw output of a ClusterScan to a file with a descriptive header
+func (e *exporter) export(ctx context.Context, name string) error {
+	fmt.Printf("[INFO] Processing scan: %s\n", name)
+
+	scan := &scanv1alpha1.ClusterScan{}
+	if err := e.client.Get(ctx, client.ObjectKey{Name: name, Namespace: e.namespace}, scan); err != nil {
+		return fmt.Errorf("unable to get ClusterScan: %v", err)
+	}
+	if scan.Status.Phase != "Completed" && scan.Status.Phase != "Failed" {
+		fmt.Printf("[WARN] Scan phase is '%s' - results may be unavailable\n", scan.Status.Phase)
+	}
+	if scan.Status.LatestReport == "" {
+		return fmt.Errorf("no ScanReport found; the scan may still be running or failed before producing output")
+	}
+
+	report := &scanv1alpha1.ScanReport{}
+	if err := e.client.Get(ctx, client.ObjectKey{Name: scan.Status.LatestReport, Namespace: e.namespace}, report); err != nil {
+		return fmt.Errorf("unable to get ScanReport %s: %v", scan.Status.LatestReport, err)
+	}
+
+	var output []byte
+	rawURI := "None"
+	if raw := report.Spec.RawOutput; raw != nil {
+		rawURI = raw.URI
+		store, err := e.storeFor(raw.URI)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[INFO] Reading raw output from %s\n", raw.URI)
+		if output, err = store.Get(ctx, raw.URI); err != nil {
+			return err
+		}
+		if resultstore.Checksum(output) != raw.Checksum {
+			fmt.Printf("[WARN] Checksum of %s does not match the report\n", raw.URI)
+		}
+	} else {
+		fmt.Println("[WARN] Raw output was not stored - exporting the summary only")
+	}
+
+	if err := os.MkdirAll(e.dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create %s: %v", e.dir, err)
+	}
+	now := time.Now()
+	fileName := "result_" + sanitize(scan.Spec.Image)
+	if scan.Spec.Target != "" {
+		fileName += "_" + sanitize(scan.Spec.Target)
+	}
+	path := filepath.Join(e.dir, fileName+"_"+now.Format("20060102_150405")+".txt")
+
+	exitCode := "N/A"
+	if scan.Status.ScanExitCode != nil {
+		exitCode = fmt.Sprint(*scan.Status.ScanExitCode)
+	}
+	completed := "N/A"
+	if scan.Status.LastRunTime != nil {
+		completed = scan.Status.LastRunTime.Format(time.RFC3339)
+	}
+	summary := report.Spec.Summary
+	rule := strings.Repeat("=", 80)
+
+	var b strings.Builder
+	fmt.Fprintln(&b, rule)
+	fmt.Fprintln(&b, "CLUSTERSCAN EXPORT")
+	fmt.Fprintln(&b, rule)
+	fmt.Fprintf(&b, "Resource:        %s\n", scan.Name)
+	fmt.Fprintf(&b, "Scanner:         %s\n", scan.Spec.Image)
+	fmt.Fprintf(&b, "Target:          %s\n", valueOr(scan.Spec.Target, "None"))
+	fmt.Fprintf(&b, "Schedule:        %s\n", valueOr(scan.Spec.Schedule, "One-time execution"))
+	fmt.Fprintf(&b, "Status:          %s\n", scan.Status.Phase)
+	fmt.Fprintf(&b, "Exit Code:       %s\n", exitCode)
+	fmt.Fprintf(&b, "Result:          %s\n", valueOr(report.Spec.Result, "N/A"))
+	fmt.Fprintf(&b, "Completed:       %s\n", completed)
+	fmt.Fprintf(&b, "Findings:        critical=%d high=%d medium=%d low=%d\n",
+		summary.Critical, summary.High, summary.Medium, summary.Low)
+	fmt.Fprintf(&b, "Exported:        %s\n", now.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(&b, "Source Report:   %s\n", report.Name)
+	fmt.Fprintf(&b, "Raw Output:      %s\n", rawURI)
+	fmt.Fprintln(&b, rule)
+	fmt.Fprintln(&b)
+	b.Write(output)
+
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	fmt.Printf("[SUCCESS] Exported %s (%d bytes of scanner output) to %s\n", scan.Name, len(output), path)
+	return nil
+}
+
+// storeFor returns a store able to read uri. Output kept on the manager's PVC is not
+// reachable from outside the cluster.
+func (e *exporter) storeFor(uri string) (resultstore.Store, error) {
+	switch {
+	case strings.HasPrefix(uri, resultstore.TypeConfigMap+"://"):
+		return resultstore.NewConfigMapStore(e.client, scheme), nil
+	case strings.HasPrefix(uri, resultstore.TypeS3+"://"):
+		if e.s3.Endpoint == "" {
+			return nil, fmt.Errorf("raw output is stored at %s; pass --s3-endpoint to download it", uri)
+		}
+		config := e.s3
+		config.Bucket, _, _ = strings.Cut(strings.TrimPrefix(uri, resultstore.TypeS3+"://"), "/")
+		return resultstore.NewS3Store(config)
+	default:
+		return nil, fmt.Errorf("raw output is stored at %s on the manager's volume; copy it from there", uri)
+	}
+}
+
+// sanitize makes an image reference safe to use in a file name
+func sanitize(s string) string {
+	s = strings.NewReplacer("/", "_", ":", "_", ".", "_").Replace(s)
+	for strings.Contains(s, "__") {
+		s = strings.ReplaceAll(s, "__", "_")
+	}
+	return s
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+func fail(format string, args ...any) {
+	fmt.Printf("[ERROR] "+format+"\n", args...)
+	os.Exit(1)
+}
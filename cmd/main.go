@@ -3,7 +3,11 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
+	"math"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -11,6 +15,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -19,6 +24,7 @@ import (
 
 	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
 	"github.com/ahmali3/clusterscan-operator/internal/controller"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
 	webhookv1alpha1 "github.com/ahmali3/clusterscan-operator/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
@@ -44,6 +50,12 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var resultStoreConfig resultstore.Config
+	var resultCacheTTL time.Duration
+	var orphanSweepInterval time.Duration
+	var jobTTLSeconds int
+	var imageGate webhookv1alpha1.ImageGateConfig
+	var imageGateExemptNamespaces string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -62,14 +74,55 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&resultStoreConfig.Type, "result-store", resultstore.TypeConfigMap,
+		"Where raw scanner output is kept: configmap, pvc or s3.")
+	flag.StringVar(&resultStoreConfig.Path, "result-store-path", "/var/lib/clusterscan/results",
+		"The directory raw output is written to when --result-store=pvc. Mount a PersistentVolume here.")
+	flag.StringVar(&resultStoreConfig.S3.Endpoint, "s3-endpoint", "",
+		"The S3-compatible endpoint (host[:port]) used when --result-store=s3.")
+	flag.StringVar(&resultStoreConfig.S3.Bucket, "s3-bucket", "", "The bucket raw output is uploaded to.")
+	flag.StringVar(&resultStoreConfig.S3.Prefix, "s3-prefix", "", "A prefix added to every uploaded object key.")
+	flag.StringVar(&resultStoreConfig.S3.Region, "s3-region", "", "The bucket region.")
+	flag.BoolVar(&resultStoreConfig.S3.Insecure, "s3-insecure", false,
+		"If set, the S3 endpoint is accessed over plain HTTP (e.g. in-cluster MinIO without TLS).")
+	flag.DurationVar(&resultCacheTTL, "result-cache-ttl", 0,
+		"How long a scan result is reused by other scans of the same image digest with the same scanner "+
+			"instead of running a new Job. Trivy does not report its vulnerability database version, so Trivy "+
+			"results are reused across database updates until the TTL expires. 0 disables the cache.")
+	flag.DurationVar(&orphanSweepInterval, "orphan-sweep-interval", time.Hour,
+		"How often results ConfigMaps whose ClusterScan no longer exists are deleted. 0 disables the sweep.")
+	flag.IntVar(&jobTTLSeconds, "job-ttl-seconds-after-finished", 0,
+		"How long finished scan Jobs and their Pods are kept once their results are recorded, for ClusterScans "+
+			"that do not set spec.ttlSecondsAfterFinished. Unset, they are kept.")
+	flag.StringVar(&imageGate.Mode, "image-gate", webhookv1alpha1.ImageGateOff,
+		"Admission of Pods and Deployments whose images violate their latest scan's failure policy: "+
+			"off, audit (admit with warnings) or enforce (reject). Requires config/webhook/imagegate.yaml to be deployed.")
+	flag.StringVar(&imageGateExemptNamespaces, "image-gate-exempt-namespaces", "kube-system",
+		"Comma-separated namespaces the image gate never checks.")
+	flag.BoolVar(&imageGate.RequireScan, "image-gate-require-scan", false,
+		"If set, the image gate also flags images that have never been scanned.")
+	flag.BoolVar(&imageGate.FailClosed, "image-gate-fail-closed", false,
+		"If set, the image gate rejects workloads when scan results cannot be looked up. It does not apply while "+
+			"the webhook itself is unreachable: the API server then admits them unless the failurePolicy in "+
+			"config/webhook/imagegate.yaml is changed to Fail.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
+	if imageGateExemptNamespaces != "" {
+		imageGate.ExemptNamespaces = strings.Split(imageGateExemptNamespaces, ",")
+	}
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	switch imageGate.Mode {
+	case webhookv1alpha1.ImageGateOff, webhookv1alpha1.ImageGateAudit, webhookv1alpha1.ImageGateEnforce:
+	default:
+		setupLog.Error(nil, "invalid --image-gate: must be off, audit or enforce", "mode", imageGate.Mode)
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -136,6 +189,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "cd9c63aa.ahmali3.github.io",
+		// Workloads are cached cluster-wide for TargetSelectors, so only the fields they need are kept
+		Cache: cache.Options{ByObject: controller.WorkloadCacheObjects()},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -149,22 +204,81 @@ func main() {
 		os.Exit(1)
 	}
 
+	resultStore, err := resultstore.New(resultStoreConfig, mgr.GetClient(), mgr.GetScheme())
+	if err != nil {
+		setupLog.Error(err, "unable to create result store", "type", resultStoreConfig.Type)
+		os.Exit(1)
+	}
+
+	var jobTTL *int32
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "job-ttl-seconds-after-finished" {
+			return
+		}
+		if jobTTLSeconds < 0 || jobTTLSeconds > math.MaxInt32 {
+			setupLog.Error(fmt.Errorf("must be between 0 and %d, got %d", math.MaxInt32, jobTTLSeconds),
+				"invalid --job-ttl-seconds-after-finished")
+			os.Exit(1)
+		}
+		seconds := int32(jobTTLSeconds)
+		jobTTL = &seconds
+	})
+
 	// 2. Pass it to the Reconciler
 	if err := (&controller.ClusterScanReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		Recorder:   mgr.GetEventRecorderFor("clusterscan-controller"),
-		KubeClient: kubeClient,
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Recorder:    mgr.GetEventRecorderFor("clusterscan-controller"),
+		KubeClient:  kubeClient,
+		ResultStore: resultStore,
+		CacheTTL:    resultCacheTTL,
+		JobTTL:      jobTTL,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterScan")
 		os.Exit(1)
 	}
+	if orphanSweepInterval > 0 {
+		if err := mgr.Add(&controller.OrphanSweeper{
+			Client:   mgr.GetClient(),
+			Interval: orphanSweepInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to add orphan sweeper")
+			os.Exit(1)
+		}
+	}
+	if err := (&controller.ScanExceptionReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Recorder:    mgr.GetEventRecorderFor("scanexception-controller"),
+		ResultStore: resultStore,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ScanException")
+		os.Exit(1)
+	}
+	if err := (&controller.ClusterScanExceptionReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Recorder:    mgr.GetEventRecorderFor("clusterscanexception-controller"),
+		ResultStore: resultStore,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterScanException")
+		os.Exit(1)
+	}
 
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
 		if err := (&webhookv1alpha1.ClusterScanWebhook{}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterScan")
 			os.Exit(1)
 		}
+		if imageGate.Mode != webhookv1alpha1.ImageGateOff {
+			if err := (&webhookv1alpha1.ImageGateWebhook{
+				Client: mgr.GetClient(),
+				Config: imageGate,
+			}).SetupWebhookWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create webhook", "webhook", "ImageGate")
+				os.Exit(1)
+			}
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
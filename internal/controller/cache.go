@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// CacheKeyLabel is set on ScanReports whose image digest is known. Its value hashes the scan Pod
+// spec and the digest, so reports with equal values scanned the same image the same way.
+const CacheKeyLabel = "scan.ahmali3.github.io/cache-key"
+
+// cacheKey identifies a scan of an image digest by the Pod spec it runs with, so scanners,
+// commands, environment such as severity filters, credentials, sidecars or volumes that differ
+// never share results. One-off scans are rendered like selector scans, reading the image from
+// $(SCAN_TARGET), so both share entries.
+func cacheKey(clusterScan *scanv1alpha1.ClusterScan, digest string) string {
+	scan := clusterScan.DeepCopy()
+	if target := scan.Spec.Target; target != "" {
+		for i, arg := range scan.Spec.Command {
+			scan.Spec.Command[i] = strings.ReplaceAll(arg, target, "$("+TargetEnvVar+")")
+		}
+		scan.Spec.Target, scan.Spec.TargetSelector = "", &scanv1alpha1.TargetSelector{}
+	}
+	template := scanPodTemplate(scan)
+	sum := sha256.Sum256([]byte(podSpecHash(&template.Spec) + "\x00" + resultsContainer(scan) + "\x00" + digest))
+	// Label values are limited to 63 characters
+	return hex.EncodeToString(sum[:])[:40]
+}
+
+// podImageField indexes Pods by the images of their containers, so the digest a tag resolves to
+// is looked up without listing every Pod in the cluster
+const podImageField = "spec.containers.image"
+
+// podImages returns the index values of a Pod for podImageField
+func podImages(obj client.Object) []string {
+	pod := obj.(*corev1.Pod)
+	var images []string
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+// resolveDigest returns the digest of an image reference: the reference's own digest when it is
+// pinned, otherwise the digest a running Pod pulled for it. It returns "" when neither is known.
+func (r *ClusterScanReconciler) resolveDigest(ctx context.Context, image string) (string, error) {
+	if digest := digestOf(image); digest != "" {
+		return digest, nil
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.MatchingFields{podImageField: image}); err != nil {
+		return "", fmt.Errorf("unable to list pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+				if c.Name == status.Name && c.Image == image {
+					if digest := digestOf(status.ImageID); digest != "" {
+						return digest, nil
+					}
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// findCachedReport returns the newest report in any namespace that scanned digest with the same
+// scanner image and command within the cache TTL, or nil. A report is only reused when it was
+// produced with the newest vulnerability database any fresh report of the scanner recorded.
+func (r *ClusterScanReconciler) findCachedReport(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	digest string) (*scanv1alpha1.ScanReport, error) {
+	reports := &scanv1alpha1.ScanReportList{}
+	if err := r.List(ctx, reports); err != nil {
+		return nil, fmt.Errorf("unable to list scan reports: %v", err)
+	}
+
+	key := cacheKey(clusterScan, digest)
+	cutoff := time.Now().Add(-r.CacheTTL)
+	var latestDB string
+	var candidates []*scanv1alpha1.ScanReport
+	for i := range reports.Items {
+		report := &reports.Items[i]
+		finished := report.Spec.CompletionTime
+		if report.Spec.Scanner.Image != clusterScan.Spec.Image || finished == nil || finished.Time.Before(cutoff) {
+			continue
+		}
+		if report.Spec.Scanner.DBVersion > latestDB {
+			latestDB = report.Spec.Scanner.DBVersion
+		}
+		// Only reuse reports that ran a Job, so cached copies never extend their source's lifetime
+		if report.Labels[CacheKeyLabel] == key && report.Spec.CachedFrom == "" && report.Spec.RawOutput != nil {
+			candidates = append(candidates, report)
+		}
+	}
+
+	var newest *scanv1alpha1.ScanReport
+	for _, report := range candidates {
+		if report.Spec.Scanner.DBVersion != latestDB {
+			continue
+		}
+		if newest == nil || report.Spec.CompletionTime.After(newest.Spec.CompletionTime.Time) {
+			newest = report
+		}
+	}
+	return newest, nil
+}
+
+// reuseCachedResult creates the report for a run from a fresh cached result instead of running a
+// Job named jobName. It returns nil when caching is disabled, the digest of target is unknown or
+// no fresh result exists.
+func (r *ClusterScanReconciler) reuseCachedResult(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	jobName, target, digest string) (*scanv1alpha1.ScanReport, error) {
+	log := ctrl.LoggerFrom(ctx)
+	if r.CacheTTL <= 0 || target == "" {
+		return nil, nil
+	}
+
+	if digest == "" {
+		var err error
+		if digest, err = r.resolveDigest(ctx, target); err != nil || digest == "" {
+			return nil, err
+		}
+	}
+	source, err := r.findCachedReport(ctx, clusterScan, digest)
+	if err != nil || source == nil {
+		return nil, err
+	}
+
+	sourceName := source.Namespace + "/" + source.Name
+	output, err := r.resultStore().Get(ctx, source.Spec.RawOutput.URI)
+	if err != nil {
+		// The source's output may have been pruned since it was listed; scan instead
+		log.Info("Cached scan output unavailable", "report", sourceName, "reason", err.Error())
+		return nil, nil
+	}
+
+	// The run is described by the source's timestamps so a reused result never appears fresher
+	run := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        jobName,
+			Namespace:   clusterScan.Namespace,
+			Annotations: map[string]string{TargetAnnotation: target},
+		},
+		Status: batchv1.JobStatus{StartTime: source.Spec.StartTime, CompletionTime: source.Spec.CompletionTime},
+	}
+	report, err := r.storeScanResults(ctx, clusterScan, run, output, source.Spec.ExitCode, sourceName)
+	if err != nil {
+		return nil, err
+	}
+	r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "CacheHit",
+		"Reused results of %s for %s (%s)", sourceName, target, digest)
+	return report, nil
+}
+
+// recordCachedRun adds a run that reused a cached result to the ClusterScan history
+func recordCachedRun(clusterScan *scanv1alpha1.ClusterScan, report *scanv1alpha1.ScanReport) {
+	run := scanv1alpha1.ScanRun{
+		JobName:        report.Spec.JobName,
+		Outcome:        RunSucceeded,
+		StartTime:      report.Spec.StartTime,
+		CompletionTime: report.Spec.CompletionTime,
+		Report:         report.Name,
+		ExitCode:       report.Spec.ExitCode,
+		PolicyViolated: len(report.Spec.PolicyViolations) > 0,
+		CachedFrom:     report.Spec.CachedFrom,
+		Result:         report.Spec.Result,
+	}
+	clusterScan.Status.LastRunTime = run.CompletionTime
+
+	successful, failed := historyLimits(clusterScan)
+	clusterScan.Status.History = trimHistory(append([]scanv1alpha1.ScanRun{run}, clusterScan.Status.History...), successful, failed)
+}
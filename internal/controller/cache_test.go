@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+)
+
+var _ = Describe("Result cache", func() {
+	const digest = "sha256:df13abe416e37eb3db4722840dd479b00ba193ac6606e7902331dcea50f4f1f2"
+	const target = "nginx@" + digest
+
+	var (
+		store resultstore.Store
+		r     *ClusterScanReconciler
+	)
+
+	newScan := func(namespace string) *scanv1alpha1.ClusterScan {
+		return &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: namespace},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:0.50.0", Target: target},
+		}
+	}
+
+	// sourceReport stores trivy output for a scan in namespace team-a that finished at finishedAt
+	sourceReport := func(finishedAt time.Time, dbVersion string) *scanv1alpha1.ScanReport {
+		stored, err := store.Put(context.Background(), resultstore.Object{Namespace: "team-a", Name: "nginx-job-results"},
+			[]byte(trivyOutput))
+		Expect(err).NotTo(HaveOccurred())
+		finished := metav1.NewTime(finishedAt)
+		return &scanv1alpha1.ScanReport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "nginx-job", Namespace: "team-a",
+				Labels: map[string]string{CacheKeyLabel: cacheKey(newScan("team-a"), digest)},
+			},
+			Spec: scanv1alpha1.ScanReportSpec{
+				ScanName: "nginx", JobName: "nginx-job", Target: target, TargetDigest: digest,
+				Scanner:        scanv1alpha1.ScannerInfo{Type: "trivy", Image: "aquasec/trivy:0.50.0", DBVersion: dbVersion},
+				CompletionTime: &finished,
+				RawOutput:      stored,
+			},
+		}
+	}
+
+	newReconciler := func(objs ...client.Object) {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(objs...).WithStatusSubresource(&scanv1alpha1.ClusterScan{}).
+			WithIndex(&corev1.Pod{}, podImageField, podImages).Build()
+		r = &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20),
+			ResultStore: store, CacheTTL: time.Hour}
+	}
+
+	BeforeEach(func() {
+		var err error
+		store, err = resultstore.NewFileStore(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reuse a fresh result from another namespace instead of creating a Job", func() {
+		scan := newScan("team-b")
+		newReconciler(scan, sourceReport(time.Now().Add(-10*time.Minute), ""))
+
+		_, err := r.reconcileJob(context.Background(), scan)
+		Expect(err).NotTo(HaveOccurred())
+
+		jobs := &batchv1.JobList{}
+		Expect(r.List(context.Background(), jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+
+		Expect(scan.Status.Phase).To(Equal(PhaseCompleted))
+		Expect(scan.Status.History).To(HaveLen(1))
+		Expect(scan.Status.History[0].CachedFrom).To(Equal("team-a/nginx-job"))
+		Expect(scan.Status.History[0].Result).To(Equal(scanv1alpha1.ResultFindingsDetected))
+		Expect(scan.Status.Summary.Critical).To(Equal(int32(2)))
+
+		report := &scanv1alpha1.ScanReport{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Name: "nginx-job", Namespace: "team-b"}, report)).To(Succeed())
+		Expect(report.Spec.CachedFrom).To(Equal("team-a/nginx-job"))
+		Expect(report.Spec.RawOutput.URI).To(ContainSubstring("team-b"))
+
+		// Later reconciles must not launch the Job the cache hit replaced
+		_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scan)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.List(context.Background(), jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+	})
+
+	It("should not reuse results older than the TTL", func() {
+		scan := newScan("team-b")
+		newReconciler(sourceReport(time.Now().Add(-2*time.Hour), ""))
+
+		found, err := r.findCachedReport(context.Background(), scan, digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeNil())
+	})
+
+	It("should not reuse results from an older vulnerability database", func() {
+		scan := newScan("team-b")
+		newer := sourceReport(time.Now().Add(-5*time.Minute), "2024-11-30T00:00:00Z")
+		newer.Name, newer.Namespace, newer.Labels = "redis-job", "team-c", nil
+		newReconciler(sourceReport(time.Now().Add(-10*time.Minute), "2024-11-29T00:00:00Z"), newer)
+
+		found, err := r.findCachedReport(context.Background(), scan, digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeNil())
+	})
+
+	It("should bound Trivy results by the TTL alone, as Trivy does not report its database", func() {
+		parsed, err := trivyParser{}.Parse([]byte(trivyOutput))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.DBVersion).To(BeEmpty())
+
+		// A result from before a database update is still reused while it is within the TTL
+		scan := newScan("team-b")
+		newReconciler(sourceReport(time.Now().Add(-5*time.Hour), parsed.DBVersion))
+		r.CacheTTL = 6 * time.Hour
+
+		found, err := r.findCachedReport(context.Background(), scan, digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).NotTo(BeNil())
+	})
+
+	It("should key results by scanner command", func() {
+		custom := newScan("team-b")
+		custom.Spec.Command = []string{"trivy", "image", "--severity", "CRITICAL", target}
+		Expect(cacheKey(custom, digest)).NotTo(Equal(cacheKey(newScan("team-b"), digest)))
+
+		selector := newScan("team-b")
+		selector.Spec.Target = ""
+		selector.Spec.TargetSelector = &scanv1alpha1.TargetSelector{}
+		Expect(cacheKey(selector, digest)).To(Equal(cacheKey(newScan("team-b"), digest)))
+	})
+
+	It("should not share results between scans whose environment differs", func() {
+		critical := newScan("team-b")
+		critical.Spec.Env = []corev1.EnvVar{{Name: "TRIVY_SEVERITY", Value: "CRITICAL"}}
+		Expect(cacheKey(critical, digest)).NotTo(Equal(cacheKey(newScan("team-b"), digest)))
+		newReconciler(sourceReport(time.Now().Add(-10*time.Minute), ""))
+
+		found, err := r.findCachedReport(context.Background(), critical, digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeNil())
+		found, err = r.findCachedReport(context.Background(), newScan("team-b"), digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).NotTo(BeNil())
+	})
+
+	It("should resolve tags to the digest a Pod running them pulled", func() {
+		running := func(name, image, imageID string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+				Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ImageID: imageID}}},
+			}
+		}
+		newReconciler(running("redis", "redis:7", "docker.io/library/redis@sha256:0123"),
+			running("web", "nginx:1.25", "docker.io/library/nginx@"+digest))
+
+		resolved, err := r.resolveDigest(context.Background(), "nginx:1.25")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(Equal(digest))
+		resolved, err = r.resolveDigest(context.Background(), "nginx:1.27")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(BeEmpty())
+	})
+})
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// CleanupFinalizer holds a deleted ClusterScan until its stored results, reports and Jobs are
+// removed. Owner references only cover objects in the ClusterScan's namespace, not raw output
+// in a file or S3 result store.
+const CleanupFinalizer = "scan.ahmali3.github.io/cleanup"
+
+// finalize cleans up after a deleted ClusterScan and releases it
+func (r *ClusterScanReconciler) finalize(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(clusterScan, CleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.cleanup(ctx, clusterScan); err != nil {
+		return ctrl.Result{}, err
+	}
+	controllerutil.RemoveFinalizer(clusterScan, CleanupFinalizer)
+	return ctrl.Result{}, client.IgnoreNotFound(r.Update(ctx, clusterScan))
+}
+
+// cleanup deletes the raw output and ScanReports of every run of a ClusterScan, and its Jobs
+// including those left by earlier specs. Raw output that cannot be deleted, e.g. because the
+// manager is no longer configured for its store, is reported but does not block the deletion.
+func (r *ClusterScanReconciler) cleanup(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	reportList := &scanv1alpha1.ScanReportList{}
+	if err := r.List(ctx, reportList, client.InNamespace(clusterScan.Namespace),
+		client.MatchingLabels{ScanNameLabel: clusterScan.Name}); err != nil {
+		return fmt.Errorf("unable to list scan reports: %v", err)
+	}
+	uris := map[string]bool{}
+	if clusterScan.Status.RawOutput != nil {
+		uris[clusterScan.Status.RawOutput.URI] = true
+	}
+	for i := range reportList.Items {
+		report := &reportList.Items[i]
+		if report.Spec.RawOutput != nil {
+			uris[report.Spec.RawOutput.URI] = true
+		}
+		if err := r.Delete(ctx, report); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete ScanReport %s: %v", report.Name, err)
+		}
+	}
+	for uri := range uris {
+		if err := r.resultStore().Delete(ctx, uri); err != nil {
+			log.Error(err, "Failed to delete raw scan output", "uri", uri)
+			r.Recorder.Eventf(clusterScan, corev1.EventTypeWarning, "CleanupFailed", "Could not delete raw output %s: %v", uri, err)
+		}
+	}
+
+	jobList := &batchv1.JobList{}
+	if err := r.List(ctx, jobList, client.InNamespace(clusterScan.Namespace),
+		client.MatchingLabels{ScanNameLabel: clusterScan.Name}); err != nil {
+		return fmt.Errorf("unable to list jobs: %v", err)
+	}
+	for i := range jobList.Items {
+		job := &jobList.Items[i]
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete job %s: %v", job.Name, err)
+		}
+	}
+	log.Info("Cleaned up deleted ClusterScan", "reports", len(reportList.Items), "results", len(uris), "jobs", len(jobList.Items))
+	return nil
+}
+
+// OrphanSweeper periodically deletes results ConfigMaps whose ClusterScan no longer exists,
+// such as those of ClusterScans deleted before the cleanup finalizer was added, or of an earlier
+// ClusterScan with the same name
+type OrphanSweeper struct {
+	client.Client
+	Interval time.Duration
+}
+
+// Start sweeps once and then every Interval until ctx is cancelled
+func (s *OrphanSweeper) Start(ctx context.Context) error {
+	log := ctrl.Log.WithName("orphan-sweeper")
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := s.sweep(ctx)
+		if err != nil {
+			log.Error(err, "Orphan sweep failed")
+		} else if deleted > 0 {
+			log.Info("Deleted orphaned results", "configMaps", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection makes only the leader sweep
+func (s *OrphanSweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// sweep deletes the orphaned results ConfigMaps and returns how many it deleted
+func (s *OrphanSweeper) sweep(ctx context.Context) (int, error) {
+	configMaps := &corev1.ConfigMapList{}
+	if err := s.List(ctx, configMaps, client.HasLabels{ScanNameLabel}); err != nil {
+		return 0, fmt.Errorf("unable to list results ConfigMaps: %v", err)
+	}
+
+	deleted := 0
+	for i := range configMaps.Items {
+		configMap := &configMaps.Items[i]
+		orphaned, err := s.orphaned(ctx, configMap)
+		if err != nil {
+			return deleted, err
+		}
+		if !orphaned {
+			continue
+		}
+		if err := s.Delete(ctx, configMap); client.IgnoreNotFound(err) != nil {
+			return deleted, fmt.Errorf("failed to delete ConfigMap %s/%s: %v", configMap.Namespace, configMap.Name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// orphaned reports whether the ClusterScan a results ConfigMap belongs to is gone. A ClusterScan
+// recreated with the same name has a new UID, so it does not adopt the old results.
+func (s *OrphanSweeper) orphaned(ctx context.Context, configMap *corev1.ConfigMap) (bool, error) {
+	clusterScan := &scanv1alpha1.ClusterScan{}
+	err := s.Get(ctx, client.ObjectKey{Name: configMap.Labels[ScanNameLabel], Namespace: configMap.Namespace}, clusterScan)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to get ClusterScan: %v", err)
+	}
+	owner := metav1.GetControllerOf(configMap)
+	return owner != nil && owner.Kind == "ClusterScan" && owner.UID != clusterScan.UID, nil
+}
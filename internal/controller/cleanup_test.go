@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+)
+
+var _ = Describe("Cleanup", func() {
+	ctx := context.Background()
+	results := func(r *ClusterScanReconciler, clusterScan *scanv1alpha1.ClusterScan, name string) *scanv1alpha1.StoredResult {
+		stored, err := resultstore.NewConfigMapStore(r.Client, r.Scheme).Put(ctx, resultstore.Object{
+			Namespace: clusterScan.Namespace,
+			Name:      name,
+			Labels:    map[string]string{ScanNameLabel: clusterScan.Name},
+			Owner:     clusterScan,
+		}, []byte(`{"Results":[]}`))
+		Expect(err).NotTo(HaveOccurred())
+		return stored
+	}
+
+	It("should delete the results, reports and Jobs of a deleted ClusterScan", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		clusterScan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25"},
+		}
+		r := &ClusterScanReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(clusterScan).
+				WithStatusSubresource(&scanv1alpha1.ClusterScan{}, &batchv1.Job{}).Build(),
+			Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20),
+		}
+		key := client.ObjectKeyFromObject(clusterScan)
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, clusterScan)).To(Succeed())
+		Expect(clusterScan.Finalizers).To(ContainElement(CleanupFinalizer))
+
+		// A report from an earlier run, and a Job left by an earlier spec
+		Expect(r.Create(ctx, &scanv1alpha1.ScanReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job-g0", Namespace: "default", Labels: map[string]string{ScanNameLabel: "nginx"}},
+			Spec:       scanv1alpha1.ScanReportSpec{RawOutput: results(r, clusterScan, "nginx-job-g0-results")},
+		})).To(Succeed())
+		Expect(r.Create(ctx, &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job-g0", Namespace: "default", Labels: map[string]string{ScanNameLabel: "nginx"}},
+		})).To(Succeed())
+
+		Expect(r.Delete(ctx, clusterScan)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(errors.IsNotFound(r.Get(ctx, key, &scanv1alpha1.ClusterScan{}))).To(BeTrue())
+		reports := &scanv1alpha1.ScanReportList{}
+		Expect(r.List(ctx, reports)).To(Succeed())
+		Expect(reports.Items).To(BeEmpty())
+		jobs := &batchv1.JobList{}
+		Expect(r.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+		configMaps := &corev1.ConfigMapList{}
+		Expect(r.List(ctx, configMaps)).To(Succeed())
+		Expect(configMaps.Items).To(BeEmpty())
+	})
+
+	It("should sweep results whose ClusterScan is gone or was recreated", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		current := &scanv1alpha1.ClusterScan{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "new"}}
+		recreated := &scanv1alpha1.ClusterScan{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "old"}}
+		deleted := &scanv1alpha1.ClusterScan{ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "default", UID: "gone"}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(current).Build()
+		r := &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme}
+		results(r, current, "nginx-job-results")
+		results(r, recreated, "nginx-job-g1-results")
+		results(r, deleted, "redis-job-results")
+		Expect(c.Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "default"}})).To(Succeed())
+
+		sweeper := &OrphanSweeper{Client: c}
+		deletedCount, err := sweeper.sweep(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deletedCount).To(Equal(2))
+
+		configMaps := &corev1.ConfigMapList{}
+		Expect(c.List(ctx, configMaps)).To(Succeed())
+		Expect(configMaps.Items).To(ConsistOf(
+			HaveField("Name", "nginx-job-results"),
+			HaveField("Name", "unrelated"),
+		))
+	})
+})
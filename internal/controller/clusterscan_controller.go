@@ -3,10 +3,13 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,10 +18,15 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
 )
 
 const (
@@ -28,21 +36,64 @@ const (
 	PhaseCompleted = "Completed"
 	PhaseFailed    = "Failed"
 	PhaseSuspended = "Suspended"
+
+	// PhasePolicyViolated means the scan completed but its findings exceeded the failure policy
+	PhasePolicyViolated = "PolicyViolated"
+
+	// PhaseTimedOut means the scan run was stopped when it exceeded spec.timeout
+	PhaseTimedOut = "TimedOut"
+)
+
+// Condition types set on ClusterScan status
+const (
+	ConditionReady            = "Ready"
+	ConditionLastRunSucceeded = "LastRunSucceeded"
+	ConditionPolicyViolated   = "PolicyViolated"
 )
 
+// ScanNameLabel is set on every object created for a ClusterScan
+const ScanNameLabel = "scan.ahmali3.github.io/name"
+
 type ClusterScanReconciler struct {
 	client.Client
 	Scheme     *runtime.Scheme
 	Recorder   record.EventRecorder
 	KubeClient kubernetes.Interface
+
+	// ResultStore holds raw scanner output; ConfigMaps are used when unset
+	ResultStore resultstore.Store
+
+	// CacheTTL is how long a result may be reused by scans of the same image digest with the
+	// same scanner; zero disables the cache
+	CacheTTL time.Duration
+
+	// JobTTL is the ttlSecondsAfterFinished of scan Jobs whose ClusterScan sets none; nil keeps
+	// finished Jobs
+	JobTTL *int32
+}
+
+func (r *ClusterScanReconciler) resultStore() resultstore.Store {
+	return defaultResultStore(r.ResultStore, r.Client, r.Scheme)
+}
+
+// defaultResultStore returns store, or the ConfigMap store when it is unset
+func defaultResultStore(store resultstore.Store, c client.Client, scheme *runtime.Scheme) resultstore.Store {
+	if store == nil {
+		return resultstore.NewConfigMapStore(c, scheme)
+	}
+	return store
 }
 
 // +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=clusterscans,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=clusterscans/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=clusterscans/finalizers,verbs=update
+// +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=scanreports,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
 
 func (r *ClusterScanReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -51,6 +102,21 @@ func (r *ClusterScanReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	if !clusterScan.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, &clusterScan)
+	}
+	if controllerutil.AddFinalizer(&clusterScan, CleanupFinalizer) {
+		if err := r.Update(ctx, &clusterScan); err != nil {
+			return ctrl.Result{}, fmt.Errorf("unable to add finalizer: %v", err)
+		}
+	}
+
+	if clusterScan.Spec.TargetSelector != nil {
+		return r.reconcileTargets(ctx, &clusterScan)
+	}
+	if fansOutToNodes(&clusterScan) {
+		return r.reconcileNodes(ctx, &clusterScan)
+	}
 	if clusterScan.Spec.Schedule != "" {
 		return r.reconcileCronJob(ctx, &clusterScan)
 	}
@@ -58,12 +124,67 @@ func (r *ClusterScanReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 }
 
 func (r *ClusterScanReconciler) reconcileJob(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan) (ctrl.Result, error) {
-	jobName := clusterScan.Name + "-job"
+	jobName := currentJobName(clusterScan)
 	job := &batchv1.Job{}
 	err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: clusterScan.Namespace}, job)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	// A Job created from an older spec is replaced by a new, uniquely named one
+	specHash := jobSpecHash(&r.constructJob(clusterScan, jobName).Spec)
+	if specChanged(clusterScan, job, err == nil, specHash) {
+		if err == nil {
+			if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil &&
+				!errors.IsNotFound(err) {
+				return ctrl.Result{}, fmt.Errorf("unable to delete outdated job: %v", err)
+			}
+		}
+		r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "SpecChanged",
+			"Spec changed since %s was created, scanning again", jobName)
+		jobName = fmt.Sprintf("%s-job-g%d", clusterScan.Name, clusterScan.Generation)
+		err = r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: clusterScan.Namespace}, job)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+	observed := clusterScan.Status.ObservedGeneration == clusterScan.Generation
+	clusterScan.Status.ObservedGeneration = clusterScan.Generation
 
 	if err != nil && errors.IsNotFound(err) {
+		if recordedRun(clusterScan, jobName) {
+			if observed {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{}, r.Status().Update(ctx, clusterScan)
+		}
+		// A run-now request asks for a fresh scan, so cached results are not reused for it
+		token := runNowToken(clusterScan)
+		var report *scanv1alpha1.ScanReport
+		if token == "" {
+			if report, err = r.reuseCachedResult(ctx, clusterScan, jobName, clusterScan.Spec.Target, ""); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if report != nil {
+			recordCachedRun(clusterScan, report)
+			clusterScan.Status.SpecHash = specHash
+			clusterScan.Status.Phase = PhaseCompleted
+			if policyViolated(clusterScan) {
+				clusterScan.Status.Phase = PhasePolicyViolated
+			}
+			meta.SetStatusCondition(&clusterScan.Status.Conditions, metav1.Condition{
+				Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "CacheHit",
+				Message: "Reused the results of " + report.Spec.CachedFrom,
+			})
+			if err := r.Status().Update(ctx, clusterScan); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, r.pruneReports(ctx, clusterScan)
+		}
+
 		desiredJob := r.constructJob(clusterScan, jobName)
+		desiredJob.Annotations = map[string]string{SpecHashAnnotation: specHash}
 		if err := controllerutil.SetControllerReference(clusterScan, desiredJob, r.Scheme); err != nil {
 			return ctrl.Result{}, err
 		}
@@ -71,8 +192,18 @@ func (r *ClusterScanReconciler) reconcileJob(ctx context.Context, clusterScan *s
 			return ctrl.Result{}, err
 		}
 		r.Recorder.Event(clusterScan, corev1.EventTypeNormal, "JobCreated", "One-off scan job created")
+		if token != "" {
+			r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "RunNow", "Manual scan run %s created", jobName)
+			if previous := clusterScan.Status.LastJobName; previous != "" && previous != jobName {
+				if err := r.deleteCollectedJob(ctx, clusterScan.Namespace, previous); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			clusterScan.Status.LastRunNowToken = token
+		}
 
 		clusterScan.Status.LastJobName = jobName
+		clusterScan.Status.SpecHash = specHash
 		clusterScan.Status.Phase = PhaseRunning
 		if err := r.Status().Update(ctx, clusterScan); err != nil {
 			return ctrl.Result{}, err
@@ -82,24 +213,49 @@ func (r *ClusterScanReconciler) reconcileJob(ctx context.Context, clusterScan *s
 
 	if err == nil {
 		condition := metav1.Condition{
-			Type: "Ready", Status: metav1.ConditionFalse, Reason: "Running", Message: "Scan is in progress",
+			Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "Running", Message: "Scan is in progress",
 		}
 		clusterScan.Status.Phase = PhaseRunning
 
-		if job.Status.Succeeded > 0 {
-			// Store scan results in ConfigMap
-			if err := r.captureAndStoreScanResults(ctx, clusterScan, job); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to store results: %v", err)
+		var collected []*batchv1.Job
+		outcome, finished := jobOutcome(job)
+		if !finished {
+			diagnostics, err := r.observeActiveJob(ctx, job)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if diagnostics != nil {
+				condition.Message = "Scan is in progress, but " + describeFailure(diagnostics)
 			}
+		}
+		if finished && needsCollection(clusterScan, job) {
+			if _, err := r.recordRun(ctx, clusterScan, job, outcome); err != nil {
+				return ctrl.Result{}, err
+			}
+			collected = append(collected, job)
+		}
 
+		switch outcome {
+		case RunSucceeded:
 			condition = metav1.Condition{
-				Type: "Ready", Status: metav1.ConditionTrue, Reason: "Completed", Message: "Scan completed successfully",
+				Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Completed", Message: "Scan completed successfully",
 			}
-			clusterScan.Status.LastRunTime = job.Status.CompletionTime
 			clusterScan.Status.Phase = PhaseCompleted
-		} else if job.Status.Failed > 0 {
+			if policyViolated(clusterScan) {
+				clusterScan.Status.Phase = PhasePolicyViolated
+			}
+		case RunTimedOut:
+			condition = metav1.Condition{
+				Type: ConditionReady, Status: metav1.ConditionFalse, Reason: batchv1.JobReasonDeadlineExceeded,
+				Message: runFailureMessage(clusterScan, job, outcome),
+			}
+			clusterScan.Status.Phase = PhaseTimedOut
+		case RunFailed:
 			condition = metav1.Condition{
-				Type: "Ready", Status: metav1.ConditionFalse, Reason: "Failed", Message: "Scan job failed",
+				Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "Failed", Message: runFailureMessage(clusterScan, job, outcome),
+			}
+			if failure := jobFailure(job); failure != nil && failure.Reason != "" {
+				condition.Reason = failure.Reason
 			}
 			clusterScan.Status.Phase = PhaseFailed
 		}
@@ -107,11 +263,21 @@ func (r *ClusterScanReconciler) reconcileJob(ctx context.Context, clusterScan *s
 		if clusterScan.Status.LastJobName != jobName {
 			clusterScan.Status.LastJobName = jobName
 		}
+		// Jobs created before the hash was kept in the status still carry it
+		if hash := job.Annotations[SpecHashAnnotation]; hash != "" {
+			clusterScan.Status.SpecHash = hash
+		}
 
 		meta.SetStatusCondition(&clusterScan.Status.Conditions, condition)
 		if err := r.Status().Update(ctx, clusterScan); err != nil {
 			return ctrl.Result{}, err
 		}
+		if err := r.markCollected(ctx, clusterScan, collected...); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.pruneReports(ctx, clusterScan); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 	return ctrl.Result{}, nil
 }
@@ -121,27 +287,25 @@ func (r *ClusterScanReconciler) reconcileCronJob(ctx context.Context, clusterSca
 	cronJob := &batchv1.CronJob{}
 	err := r.Get(ctx, types.NamespacedName{Name: cronName, Namespace: clusterScan.Namespace}, cronJob)
 
+	successfulLimit, failedLimit := historyLimits(clusterScan)
 	desiredCron := &batchv1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{Name: cronName, Namespace: clusterScan.Namespace},
 		Spec: batchv1.CronJobSpec{
-			Schedule: clusterScan.Spec.Schedule,
-			Suspend:  &clusterScan.Spec.Suspend,
+			Schedule:                   clusterScan.Spec.Schedule,
+			Suspend:                    &clusterScan.Spec.Suspend,
+			SuccessfulJobsHistoryLimit: &successfulLimit,
+			FailedJobsHistoryLimit:     &failedLimit,
 			JobTemplate: batchv1.JobTemplateSpec{
-				Spec: batchv1.JobSpec{
-					Template: corev1.PodTemplateSpec{
-						Spec: corev1.PodSpec{
-							RestartPolicy: corev1.RestartPolicyOnFailure,
-							Containers: []corev1.Container{{
-								Name:    "scanner",
-								Image:   clusterScan.Spec.Image,
-								Command: clusterScan.Spec.Command,
-							}},
-						},
-					},
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{ScanNameLabel: clusterScan.Name},
 				},
+				Spec: scanJobSpec(clusterScan),
 			},
 		},
 	}
+	r.applyJobTTL(clusterScan, &desiredCron.Spec.JobTemplate.Spec)
+	specHash := jobSpecHash(&desiredCron.Spec.JobTemplate.Spec)
+	desiredCron.Annotations = map[string]string{SpecHashAnnotation: specHash}
 
 	if err != nil && errors.IsNotFound(err) {
 		if err := controllerutil.SetControllerReference(clusterScan, desiredCron, r.Scheme); err != nil {
@@ -153,6 +317,8 @@ func (r *ClusterScanReconciler) reconcileCronJob(ctx context.Context, clusterSca
 		r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "Scheduled", "CronJob created: %s", clusterScan.Spec.Schedule)
 
 		clusterScan.Status.Phase = PhaseScheduled
+		clusterScan.Status.ObservedGeneration = clusterScan.Generation
+		setScheduledRunConditions(clusterScan)
 		if err := r.Status().Update(ctx, clusterScan); err != nil {
 			return ctrl.Result{}, err
 		}
@@ -162,147 +328,265 @@ func (r *ClusterScanReconciler) reconcileCronJob(ctx context.Context, clusterSca
 			currentSuspend = *cronJob.Spec.Suspend
 		}
 
-		if cronJob.Spec.Schedule != clusterScan.Spec.Schedule || currentSuspend != clusterScan.Spec.Suspend {
+		desiredJobSpec := desiredCron.Spec.JobTemplate.Spec
+		if cronJob.Spec.Schedule != clusterScan.Spec.Schedule || currentSuspend != clusterScan.Spec.Suspend ||
+			!int32PtrEqual(cronJob.Spec.SuccessfulJobsHistoryLimit, &successfulLimit) ||
+			!int32PtrEqual(cronJob.Spec.FailedJobsHistoryLimit, &failedLimit) ||
+			cronJob.Spec.JobTemplate.Labels[ScanNameLabel] != clusterScan.Name ||
+			!int64PtrEqual(cronJob.Spec.JobTemplate.Spec.ActiveDeadlineSeconds, desiredJobSpec.ActiveDeadlineSeconds) ||
+			!int32PtrEqual(cronJob.Spec.JobTemplate.Spec.BackoffLimit, desiredJobSpec.BackoffLimit) ||
+			!int32PtrEqual(cronJob.Spec.JobTemplate.Spec.TTLSecondsAfterFinished, desiredJobSpec.TTLSecondsAfterFinished) ||
+			!equality.Semantic.DeepEqual(cronJob.Spec.JobTemplate.Spec.PodFailurePolicy, desiredJobSpec.PodFailurePolicy) ||
+			cronJob.Annotations[SpecHashAnnotation] != specHash {
 			cronJob.Spec.Schedule = clusterScan.Spec.Schedule
 			cronJob.Spec.Suspend = &clusterScan.Spec.Suspend
+			cronJob.Spec.SuccessfulJobsHistoryLimit = &successfulLimit
+			cronJob.Spec.FailedJobsHistoryLimit = &failedLimit
+			cronJob.Spec.JobTemplate.Labels = desiredCron.Spec.JobTemplate.Labels
+			cronJob.Spec.JobTemplate.Spec.ActiveDeadlineSeconds = desiredJobSpec.ActiveDeadlineSeconds
+			cronJob.Spec.JobTemplate.Spec.BackoffLimit = desiredJobSpec.BackoffLimit
+			cronJob.Spec.JobTemplate.Spec.TTLSecondsAfterFinished = desiredJobSpec.TTLSecondsAfterFinished
+			cronJob.Spec.JobTemplate.Spec.PodFailurePolicy = desiredJobSpec.PodFailurePolicy
+			// Later runs use the current spec; Jobs already started keep theirs
+			if cronJob.Annotations[SpecHashAnnotation] != specHash {
+				cronJob.Spec.JobTemplate.Spec = desiredCron.Spec.JobTemplate.Spec
+				if cronJob.Annotations == nil {
+					cronJob.Annotations = map[string]string{}
+				}
+				cronJob.Annotations[SpecHashAnnotation] = specHash
+			}
 			if err := r.Update(ctx, cronJob); err != nil {
 				return ctrl.Result{}, err
 			}
 			r.Recorder.Event(clusterScan, corev1.EventTypeNormal, "Updated", "CronJob configuration updated")
 		}
 
+		originalStatus := clusterScan.Status.DeepCopy()
+		clusterScan.Status.ObservedGeneration = clusterScan.Generation
+
+		if err := r.runNow(ctx, clusterScan, cronJob); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		collected, active, err := r.collectScheduledRuns(ctx, clusterScan)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
 		clusterScan.Status.Phase = PhaseScheduled
-		if *cronJob.Spec.Suspend {
+		if active != nil {
+			clusterScan.Status.Phase = PhaseRunning
+			clusterScan.Status.LastJobName = active.Name
+		} else if *cronJob.Spec.Suspend {
 			clusterScan.Status.Phase = PhaseSuspended
 		}
+		setScheduledRunConditions(clusterScan)
 
-		if cronJob.Status.LastScheduleTime != nil {
-			if clusterScan.Status.LastRunTime == nil || !cronJob.Status.LastScheduleTime.Equal(clusterScan.Status.LastRunTime) {
-				clusterScan.Status.LastRunTime = cronJob.Status.LastScheduleTime
-				if err := r.Status().Update(ctx, clusterScan); err != nil {
-					return ctrl.Result{}, err
-				}
-			}
-		} else if clusterScan.Status.Phase != PhaseScheduled && !clusterScan.Spec.Suspend {
+		if !equality.Semantic.DeepEqual(originalStatus, &clusterScan.Status) {
 			if err := r.Status().Update(ctx, clusterScan); err != nil {
 				return ctrl.Result{}, err
 			}
 		}
+		if err := r.markCollected(ctx, clusterScan, collected...); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.pruneReports(ctx, clusterScan); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 	return ctrl.Result{}, nil
 }
 
+func int32PtrEqual(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func int64PtrEqual(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (r *ClusterScanReconciler) constructJob(clusterScan *scanv1alpha1.ClusterScan, name string) *batchv1.Job {
-	return &batchv1.Job{
-		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: clusterScan.Namespace},
-		Spec: batchv1.JobSpec{
-			Template: corev1.PodTemplateSpec{
-				Spec: corev1.PodSpec{
-					RestartPolicy: corev1.RestartPolicyOnFailure,
-					Containers: []corev1.Container{{
-						Name:    "scanner",
-						Image:   clusterScan.Spec.Image,
-						Command: clusterScan.Spec.Command,
-					}},
-				},
-			},
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: clusterScan.Namespace,
+			Labels:    map[string]string{ScanNameLabel: clusterScan.Name},
 		},
+		Spec: scanJobSpec(clusterScan),
 	}
+	r.applyJobTTL(clusterScan, &job.Spec)
+	return job
 }
 
-func (r *ClusterScanReconciler) captureAndStoreScanResults(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan, job *batchv1.Job) error {
+// captureAndStoreScanResults stores the output of a completed Job and creates its ScanReport.
+// The output is read from the Job's preferred scanner attempt, see rankAttempts. It returns nil
+// without error when the Job's pods or logs are no longer available.
+func (r *ClusterScanReconciler) captureAndStoreScanResults(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	job *batchv1.Job, pods []corev1.Pod) (*scanv1alpha1.ScanReport, error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	podList := &corev1.PodList{}
-	listOptions := []client.ListOption{
-		client.InNamespace(job.Namespace),
-		client.MatchingLabels{"job-name": job.Name},
-	}
-
-	if err := r.List(ctx, podList, listOptions...); err != nil {
-		return fmt.Errorf("unable to list pods: %v", err)
+	// Each run produces a single report named after its Job; skip runs that were already collected
+	existingReport := &scanv1alpha1.ScanReport{}
+	reportErr := r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existingReport)
+	if reportErr == nil {
+		clusterScan.Status.LatestReport = existingReport.Name
+		setPolicyCondition(clusterScan, existingReport.Spec.PolicyViolations, true)
+		return existingReport, nil
+	} else if !errors.IsNotFound(reportErr) {
+		return nil, fmt.Errorf("error checking ScanReport: %v", reportErr)
 	}
 
-	if len(podList.Items) == 0 {
+	if len(pods) == 0 {
 		log.Info("No pods found for completed job - skipping result storage", "job", job.Name)
 		r.Recorder.Event(clusterScan, corev1.EventTypeWarning, "NoPodsFound",
 			"Job completed but no pods found for result collection")
-		return nil
+		return nil, nil
 	}
 
-	pod := podList.Items[0]
-
-	// Use the Shared Client here instead of creating a new one
-	logRequest := r.KubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{})
-	logBytes, err := logRequest.DoRaw(ctx)
-	if err != nil {
-		log.Error(err, "Failed to retrieve pod logs", "pod", pod.Name)
+	logBytes, attempt, err := r.readAttemptLogs(ctx, clusterScan, pods)
+	if attempt == nil {
+		log.Error(err, "Failed to retrieve pod logs", "job", job.Name)
 		r.Recorder.Event(clusterScan, corev1.EventTypeWarning, "LogRetrievalFailed",
-			fmt.Sprintf("Could not retrieve logs from pod %s", pod.Name))
-		return nil
+			fmt.Sprintf("Could not retrieve logs from the pods of job %s", job.Name))
+		return nil, nil
 	}
 
-	cmName := clusterScan.Name + "-results"
-	configMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      cmName,
-			Namespace: clusterScan.Namespace,
-			Labels: map[string]string{
-				"app": "clusterscan",
-				// This label must use the correct domain
-				"scan.ahmali3.github.io/name": clusterScan.Name,
-			},
+	return r.storeScanResults(ctx, clusterScan, job, logBytes, attempt.exitCode, "")
+}
+
+// storeScanResults saves raw scanner output to the result store, parses it into a ScanReport for
+// the run and records the results in the ClusterScan status. cachedFrom names the report whose
+// output is being reused when no Job ran.
+func (r *ClusterScanReconciler) storeScanResults(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	job *batchv1.Job, logBytes []byte, exitCode *int32, cachedFrom string) (*scanv1alpha1.ScanReport, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	stored, err := r.resultStore().Put(ctx, resultstore.Object{
+		Namespace: clusterScan.Namespace,
+		Name:      job.Name + "-results",
+		Labels: map[string]string{
+			"app":         "clusterscan",
+			ScanNameLabel: clusterScan.Name,
 		},
-		Data: map[string]string{
-			"scan-output.txt": string(logBytes),
-			"scanner":         clusterScan.Spec.Image,
-			"target":          clusterScan.Spec.Target,
-			"timestamp":       time.Now().Format(time.RFC3339),
+		Metadata: map[string]string{
+			"scanner":   clusterScan.Spec.Image,
+			"target":    jobTarget(clusterScan, job),
+			"timestamp": time.Now().Format(time.RFC3339),
 		},
+		Owner: clusterScan,
+	}, logBytes)
+	if resultstore.IsTooLarge(err) {
+		// Still record the parsed report; only the raw output is lost
+		log.Info("Scan output too large for the result store", "job", job.Name, "bytes", len(logBytes))
+		r.Recorder.Event(clusterScan, corev1.EventTypeWarning, "ResultsTooLarge",
+			fmt.Sprintf("Raw output of %s not stored: %v", job.Name, err))
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to store raw output: %v", err)
+	} else {
+		r.Recorder.Event(clusterScan, corev1.EventTypeNormal, "ResultsStored",
+			fmt.Sprintf("Results stored at %s", stored.URI))
 	}
 
-	if err := controllerutil.SetControllerReference(clusterScan, configMap, r.Scheme); err != nil {
-		return fmt.Errorf("failed to set owner reference: %v", err)
+	exceptions, err := activeExceptions(ctx, r.Client, clusterScan.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	report, summary := r.buildScanReport(ctx, clusterScan, job, logBytes, exceptions)
+	report.Spec.ExitCode = exitCode
+	report.Spec.Result = classifyRun(clusterScan, exitCode, summary)
+	report.Spec.RawOutput = stored
+	report.Spec.CachedFrom = cachedFrom
+	if report.Spec.TargetDigest != "" {
+		report.Labels[CacheKeyLabel] = cacheKey(clusterScan, report.Spec.TargetDigest)
+	}
+	if err := controllerutil.SetControllerReference(clusterScan, report, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set owner reference: %v", err)
+	}
+	if err := r.Create(ctx, report); client.IgnoreAlreadyExists(err) != nil {
+		return nil, fmt.Errorf("failed to create ScanReport: %v", err)
+	}
+	r.Recorder.Event(clusterScan, corev1.EventTypeNormal, "ReportCreated",
+		fmt.Sprintf("Scan report %s created with %d findings (%d suppressed)", report.Name,
+			len(report.Spec.Findings), report.Spec.Summary.Suppressed))
+
+	clusterScan.Status.LatestReport = report.Name
+	clusterScan.Status.RawOutput = stored
+	clusterScan.Status.ScanExitCode = exitCode
+	clusterScan.Status.ScanResult = report.Spec.Result
+	clusterScan.Status.Summary = summary
+
+	setPolicyCondition(clusterScan, report.Spec.PolicyViolations, summary != nil)
+	if len(report.Spec.PolicyViolations) > 0 {
+		r.Recorder.Event(clusterScan, corev1.EventTypeWarning, "PolicyViolated",
+			fmt.Sprintf("Run %s violated the failure policy: %s", job.Name, strings.Join(report.Spec.PolicyViolations, "; ")))
 	}
 
-	existingCM := &corev1.ConfigMap{}
-	cmKey := types.NamespacedName{Name: cmName, Namespace: clusterScan.Namespace}
-	cmErr := r.Get(ctx, cmKey, existingCM)
+	return report, nil
+}
 
-	if cmErr != nil && errors.IsNotFound(cmErr) {
-		if err := r.Create(ctx, configMap); err != nil {
-			return fmt.Errorf("failed to create ConfigMap: %v", err)
-		}
-		r.Recorder.Event(clusterScan, corev1.EventTypeNormal, "ResultsStored",
-			fmt.Sprintf("Results stored in ConfigMap %s", cmName))
-	} else if cmErr == nil {
-		existingCM.Data = configMap.Data
-		if err := r.Update(ctx, existingCM); err != nil {
-			return fmt.Errorf("failed to update ConfigMap: %v", err)
-		}
-	} else {
-		return fmt.Errorf("error checking ConfigMap: %v", cmErr)
+// scannerExitCode returns the exit code of the scanner container, or nil if it has not terminated
+func scannerExitCode(pod *corev1.Pod) *int32 {
+	if status := scannerStatus(pod); status != nil && status.State.Terminated != nil {
+		exitCode := status.State.Terminated.ExitCode
+		return &exitCode
 	}
+	return nil
+}
 
-	var exitCode int32 = 0
-	if len(pod.Status.ContainerStatuses) > 0 {
-		containerStatus := pod.Status.ContainerStatuses[0]
-		if containerStatus.State.Terminated != nil {
-			exitCode = containerStatus.State.Terminated.ExitCode
-		}
+// scanCommand returns the command for the scanner container. Trivy image scans without an
+// explicit command default to JSON output so the results can be summarized. Selector scans
+// read the image from $(SCAN_TARGET), which each Job sets to its discovered image.
+func scanCommand(clusterScan *scanv1alpha1.ClusterScan) []string {
+	if len(clusterScan.Spec.Command) > 0 || scanner.DetectType(clusterScan.Spec.Image) != scanner.Trivy {
+		return clusterScan.Spec.Command
 	}
+	if clusterScan.Spec.TargetSelector != nil {
+		return []string{"trivy", "image", "--format", "json", "$(" + TargetEnvVar + ")"}
+	}
+	if clusterScan.Spec.Target != "" {
+		return []string{"trivy", "image", "--format", "json", clusterScan.Spec.Target}
+	}
+	return clusterScan.Spec.Command
+}
 
-	clusterScan.Status.ResultsConfigMap = cmName
-	clusterScan.Status.ScanExitCode = &exitCode
-
-	return nil
+// requestForScanLabel maps an object carrying the ScanNameLabel to its ClusterScan
+func (r *ClusterScanReconciler) requestForScanLabel(ctx context.Context, obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[ScanNameLabel]
+	if !ok || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}}}
 }
 
 func (r *ClusterScanReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Pod{}, podImageField, podImages); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&scanv1alpha1.ClusterScan{}).
 		Owns(&batchv1.Job{}).
 		Owns(&batchv1.CronJob{}).
 		Owns(&corev1.ConfigMap{}).
+		Owns(&scanv1alpha1.ScanReport{}).
+		// Jobs spawned by the CronJob are owned by it rather than the ClusterScan, so match them by label
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(r.requestForScanLabel)).
+		// Scan Pods that cannot start leave their Job's status unchanged, so they are watched too
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.requestForScanLabel),
+			builder.WithPredicates(scanPodStalled)).
+		// Workloads are watched for TargetSelectors in watch mode, which rescan images as they change
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.requestsForWorkload),
+			builder.WithPredicates(workloadImagesChanged)).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.requestsForWorkload),
+			builder.WithPredicates(workloadImagesChanged)).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.requestsForWorkload),
+			builder.WithPredicates(workloadImagesChanged)).
+		Watches(&appsv1.DaemonSet{}, handler.EnqueueRequestsFromMapFunc(r.requestsForWorkload),
+			builder.WithPredicates(workloadImagesChanged)).
 		Complete(r)
 }
@@ -8,6 +8,7 @@ import (
 	. "github.com/onsi/gomega"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
@@ -278,6 +279,95 @@ var _ = Describe("ClusterScan Controller", Ordered, func() {
 
 				Expect(k8sClient.Delete(ctx, scan)).To(Succeed())
 			})
+
+			// Test 5: History Retention
+			// Verifies that the ClusterScan history limits are applied to the CronJob
+			// and that spawned Jobs are labelled for result collection
+			It("should apply history limits and label spawned Jobs", func() {
+				scanName := "test-cron-history"
+				successful, failed := int32(5), int32(2)
+				scan := &scanv1alpha1.ClusterScan{
+					ObjectMeta: metav1.ObjectMeta{Name: scanName, Namespace: namespace},
+					Spec: scanv1alpha1.ClusterScanSpec{
+						Image:    "busybox",
+						Schedule: "*/5 * * * *",
+						HistoryLimit: &scanv1alpha1.HistoryLimit{
+							Successful: &successful,
+							Failed:     &failed,
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, scan)).To(Succeed())
+
+				createdCron := &batchv1.CronJob{}
+				key := types.NamespacedName{Name: scanName + "-cron", Namespace: namespace}
+				Eventually(func() error {
+					return k8sClient.Get(ctx, key, createdCron)
+				}, time.Second*10).Should(Succeed())
+
+				Expect(*createdCron.Spec.SuccessfulJobsHistoryLimit).To(Equal(int32(5)))
+				Expect(*createdCron.Spec.FailedJobsHistoryLimit).To(Equal(int32(2)))
+				Expect(createdCron.Spec.JobTemplate.Labels).To(HaveKeyWithValue(ScanNameLabel, scanName))
+
+				Expect(k8sClient.Delete(ctx, scan)).To(Succeed())
+			})
+
+			// Test 6: Scheduled Run Capture
+			// Verifies that a finished Job spawned for a scheduled scan is recorded
+			// in the history and reflected in the LastRunSucceeded condition
+			It("should record the outcome of scheduled runs", func() {
+				scanName := "test-cron-capture"
+				scan := &scanv1alpha1.ClusterScan{
+					ObjectMeta: metav1.ObjectMeta{Name: scanName, Namespace: namespace},
+					Spec: scanv1alpha1.ClusterScanSpec{
+						Image:    "busybox",
+						Schedule: "*/5 * * * *",
+					},
+				}
+				Expect(k8sClient.Create(ctx, scan)).To(Succeed())
+
+				// Stand in for the CronJob controller, which does not run in envtest
+				job := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      scanName + "-cron-1",
+						Namespace: namespace,
+						Labels:    map[string]string{ScanNameLabel: scanName},
+					},
+					Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								RestartPolicy: corev1.RestartPolicyNever,
+								Containers:    []corev1.Container{{Name: "scanner", Image: "busybox"}},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, job)).To(Succeed())
+
+				now := metav1.Now()
+				job.Status.StartTime = &now
+				job.Status.Failed = 1
+				job.Status.Conditions = []batchv1.JobCondition{
+					{Type: batchv1.JobFailureTarget, Status: corev1.ConditionTrue, LastTransitionTime: now},
+					{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: now},
+				}
+				Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+				updated := &scanv1alpha1.ClusterScan{}
+				Eventually(func() []scanv1alpha1.ScanRun {
+					_ = k8sClient.Get(ctx, types.NamespacedName{Name: scanName, Namespace: namespace}, updated)
+					return updated.Status.History
+				}, time.Second*10).Should(HaveLen(1))
+
+				Expect(updated.Status.History[0].JobName).To(Equal(job.Name))
+				Expect(updated.Status.History[0].Outcome).To(Equal(RunFailed))
+				Expect(updated.Status.LastJobName).To(Equal(job.Name))
+				Expect(updated.Status.LastRunTime).NotTo(BeNil())
+				Expect(meta.IsStatusConditionFalse(updated.Status.Conditions, ConditionLastRunSucceeded)).To(BeTrue())
+
+				Expect(k8sClient.Delete(ctx, job)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, scan)).To(Succeed())
+			})
 		})
 	})
 })
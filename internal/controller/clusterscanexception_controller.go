@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+)
+
+// ClusterScanExceptionReconciler marks ClusterScanExceptions as expired once their expiry passes,
+// and re-evaluates every ScanReport whenever they change
+type ClusterScanExceptionReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// ResultStore holds the raw scanner output reports are re-evaluated from; ConfigMaps are
+	// used when unset
+	ResultStore resultstore.Store
+}
+
+// +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=clusterscanexceptions,verbs=get;list;watch
+// +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=clusterscanexceptions/status,verbs=get;update;patch
+
+func (r *ClusterScanExceptionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	exception := &scanv1alpha1.ClusterScanException{}
+	store := defaultResultStore(r.ResultStore, r.Client, r.Scheme)
+	if err := r.Get(ctx, req.NamespacedName, exception); errors.IsNotFound(err) {
+		// A deleted exception no longer suppresses findings
+		return ctrl.Result{}, reevaluateReports(ctx, r.Client, store, "")
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	result, err := reconcileExceptionExpiry(ctx, r.Client, r.Recorder, exception, &exception.Spec, &exception.Status)
+	if err != nil {
+		return result, err
+	}
+	return result, reevaluateReports(ctx, r.Client, store, "")
+}
+
+func (r *ClusterScanExceptionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates, such as marking an exception expired, need no re-evaluation
+		For(&scanv1alpha1.ClusterScanException{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
+)
+
+// TargetCredentialsVolume is the scan Pod volume holding a DockerConfigJSON credentials Secret
+const TargetCredentialsVolume = "target-credentials"
+
+// targetCredentialsPath is where the Docker config is mounted; DOCKER_CONFIG points here
+const targetCredentialsPath = "/etc/clusterscan/registry"
+
+// applyTargetCredentials exposes the ClusterScan's registry credentials to the scanner container.
+// Trivy, Grype and most other tools read a Docker config from DOCKER_CONFIG; username and
+// password are passed in the variables of the detected scanner.
+func applyTargetCredentials(clusterScan *scanv1alpha1.ClusterScan, pod *corev1.PodSpec) {
+	credentials := clusterScan.Spec.TargetCredentials
+	if credentials == nil {
+		return
+	}
+	container := scannerContainer(pod)
+
+	if credentials.Type == scanv1alpha1.CredentialsBasicAuth {
+		username, password := credentialVariables(clusterScan)
+		container.Env = append(container.Env,
+			secretEnv(username, credentials.SecretName, corev1.BasicAuthUsernameKey),
+			secretEnv(password, credentials.SecretName, corev1.BasicAuthPasswordKey))
+		if clusterScan.Spec.Target != "" {
+			container.Env = append(container.Env, registryAuthorityEnv(clusterScan, clusterScan.Spec.Target)...)
+		}
+		return
+	}
+
+	pod.Volumes = append(pod.Volumes, corev1.Volume{
+		Name: TargetCredentialsVolume,
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+			SecretName: credentials.SecretName,
+			Items:      []corev1.KeyToPath{{Key: corev1.DockerConfigJsonKey, Path: "config.json"}},
+		}},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name: TargetCredentialsVolume, MountPath: targetCredentialsPath, ReadOnly: true,
+	})
+	container.Env = append(container.Env, corev1.EnvVar{Name: "DOCKER_CONFIG", Value: targetCredentialsPath})
+}
+
+// credentialVariables returns the environment variables the scanner reads a registry username
+// and password from
+func credentialVariables(clusterScan *scanv1alpha1.ClusterScan) (username, password string) {
+	switch scanner.DetectType(clusterScan.Spec.Image) {
+	case scanner.Trivy:
+		return "TRIVY_USERNAME", "TRIVY_PASSWORD"
+	case scanner.Grype:
+		return "GRYPE_REGISTRY_AUTH_USERNAME", "GRYPE_REGISTRY_AUTH_PASSWORD"
+	default:
+		return "REGISTRY_USERNAME", "REGISTRY_PASSWORD"
+	}
+}
+
+// registryAuthorityEnv names the registry basic-auth credentials apply to. Only Grype needs it;
+// selector scans set it per discovered image.
+func registryAuthorityEnv(clusterScan *scanv1alpha1.ClusterScan, image string) []corev1.EnvVar {
+	credentials := clusterScan.Spec.TargetCredentials
+	if credentials == nil || credentials.Type != scanv1alpha1.CredentialsBasicAuth ||
+		scanner.DetectType(clusterScan.Spec.Image) != scanner.Grype {
+		return nil
+	}
+	return []corev1.EnvVar{{Name: "GRYPE_REGISTRY_AUTH_AUTHORITY", Value: registryHost(image)}}
+}
+
+// registryHost returns the registry an image reference is pulled from
+func registryHost(image string) string {
+	host, _, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return "index.docker.io"
+	}
+	return host
+}
+
+func secretEnv(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+			Key:                  key,
+		}},
+	}
+}
@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+const (
+	// logTailLines and maxLogTailBytes bound the logs kept from a failed container, since they
+	// are stored in the ClusterScan status
+	logTailLines    int64 = 20
+	maxLogTailBytes       = 2048
+
+	// maxDescribedLine bounds the log line quoted in events and conditions
+	maxDescribedLine = 200
+)
+
+// DiagnosticsAnnotation records on a running scan Job why it is not progressing, e.g. an image
+// that cannot be pulled. Such Pods never fail the Job by themselves and are deleted when it hits
+// its deadline, so the annotation is what is left to explain the run.
+const DiagnosticsAnnotation = "scan.ahmali3.github.io/diagnostics"
+
+// failedContainer returns the diagnostics of the first failed container of a Pod, checking the
+// scanner before sidecars and init containers, and whether its logs come from the instance
+// before its last restart
+func failedContainer(pod *corev1.Pod) (*scanv1alpha1.FailureDiagnostics, bool) {
+	var statuses []corev1.ContainerStatus
+	if status := scannerStatus(pod); status != nil {
+		statuses = append(statuses, *status)
+	}
+	for _, group := range [][]corev1.ContainerStatus{pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses} {
+		for _, status := range group {
+			if status.Name != ScannerContainer {
+				statuses = append(statuses, status)
+			}
+		}
+	}
+
+	for _, status := range statuses {
+		diagnostics := &scanv1alpha1.FailureDiagnostics{Pod: pod.Name, Container: status.Name}
+		current, last, waiting := status.State.Terminated, status.LastTerminationState.Terminated, status.State.Waiting
+		switch {
+		case current != nil && current.ExitCode != 0:
+			return withTermination(diagnostics, current), false
+		case last != nil && last.ExitCode != 0:
+			// A container waiting in CrashLoopBackOff is best explained by its last crash
+			return withTermination(diagnostics, last), true
+		case waiting != nil && waiting.Reason != "" && waiting.Reason != "ContainerCreating" && waiting.Reason != "PodInitializing":
+			diagnostics.Reason, diagnostics.Message = waiting.Reason, waiting.Message
+			return diagnostics, false
+		}
+	}
+	return nil, false
+}
+
+// withTermination records how a container instance terminated
+func withTermination(diagnostics *scanv1alpha1.FailureDiagnostics,
+	terminated *corev1.ContainerStateTerminated) *scanv1alpha1.FailureDiagnostics {
+	exitCode := terminated.ExitCode
+	diagnostics.Reason, diagnostics.Message, diagnostics.ExitCode = terminated.Reason, terminated.Message, &exitCode
+	return diagnostics
+}
+
+// podDiagnostics explains the failure of a Pod whose containers did not fail, such as an
+// evicted or unschedulable Pod
+func podDiagnostics(pod *corev1.Pod) *scanv1alpha1.FailureDiagnostics {
+	diagnostics := &scanv1alpha1.FailureDiagnostics{Pod: pod.Name, Reason: pod.Status.Reason, Message: pod.Status.Message}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && diagnostics.Reason == "" {
+			diagnostics.Reason, diagnostics.Message = condition.Reason, condition.Message
+		}
+	}
+	if diagnostics.Reason == "" {
+		return nil
+	}
+	return diagnostics
+}
+
+// podFailure returns the diagnostics of the newest Pod that failed or cannot make progress, the
+// Pod, and whether the failed container's logs come from the instance before its last restart
+func podFailure(pods []corev1.Pod) (*scanv1alpha1.FailureDiagnostics, *corev1.Pod, bool) {
+	for i := len(pods) - 1; i >= 0; i-- {
+		pod := &pods[i]
+		if diagnostics, previous := failedContainer(pod); diagnostics != nil {
+			return diagnostics, pod, previous
+		}
+		if diagnostics := podDiagnostics(pod); diagnostics != nil {
+			return diagnostics, pod, false
+		}
+	}
+	return nil, nil, false
+}
+
+// failureDiagnostics inspects the newest Pod of a failed run and reads the tail of the failed
+// container's logs. When the Pods are gone, e.g. deleted at the Job's deadline, the diagnostics
+// recorded while the Job ran are used.
+func (r *ClusterScanReconciler) failureDiagnostics(ctx context.Context, job *batchv1.Job,
+	pods []corev1.Pod) *scanv1alpha1.FailureDiagnostics {
+	diagnostics, pod, previous := podFailure(pods)
+	if diagnostics == nil {
+		return jobDiagnostics(job)
+	}
+	// Containers that never started have no logs
+	if diagnostics.ExitCode != nil && r.KubeClient != nil {
+		diagnostics.LogTail = r.logTail(ctx, pod, diagnostics.Container, previous)
+	}
+	return diagnostics
+}
+
+// observeActiveJob records on a running Job why its newest Pod cannot make progress, such as an
+// image pull back-off or a missing Secret, and returns that diagnosis. Logs are not read until
+// the run fails. Diagnostics are kept when the Pods are gone, since the Job is then ending.
+func (r *ClusterScanReconciler) observeActiveJob(ctx context.Context, job *batchv1.Job) (*scanv1alpha1.FailureDiagnostics, error) {
+	pods, err := r.listJobPods(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return jobDiagnostics(job), nil
+	}
+	diagnostics, _, _ := podFailure(pods)
+
+	var value string
+	if diagnostics != nil {
+		data, err := json.Marshal(diagnostics)
+		if err != nil {
+			return nil, err
+		}
+		value = string(data)
+	}
+	if value == job.Annotations[DiagnosticsAnnotation] {
+		return diagnostics, nil
+	}
+	patch := client.MergeFrom(job.DeepCopy())
+	if value == "" {
+		delete(job.Annotations, DiagnosticsAnnotation)
+	} else {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		job.Annotations[DiagnosticsAnnotation] = value
+	}
+	if err := r.Patch(ctx, job, patch); client.IgnoreNotFound(err) != nil {
+		return nil, fmt.Errorf("failed to record diagnostics of job %s: %v", job.Name, err)
+	}
+	return diagnostics, nil
+}
+
+// jobDiagnostics returns the diagnostics recorded on a Job while it ran, or nil
+func jobDiagnostics(job *batchv1.Job) *scanv1alpha1.FailureDiagnostics {
+	value := job.Annotations[DiagnosticsAnnotation]
+	if value == "" {
+		return nil
+	}
+	diagnostics := &scanv1alpha1.FailureDiagnostics{}
+	if err := json.Unmarshal([]byte(value), diagnostics); err != nil {
+		return nil
+	}
+	return diagnostics
+}
+
+// scanPodStalled passes updates of scan Pods whose diagnosis changed, e.g. a container entering
+// ImagePullBackOff, which would otherwise go unnoticed until the Job's deadline
+var scanPodStalled = predicate.Funcs{
+	CreateFunc: func(event.CreateEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.ObjectNew.GetLabels()[ScanNameLabel] == "" {
+			return false
+		}
+		before, _, _ := podFailure([]corev1.Pod{*e.ObjectOld.(*corev1.Pod)})
+		after, _, _ := podFailure([]corev1.Pod{*e.ObjectNew.(*corev1.Pod)})
+		return describeFailure(before) != describeFailure(after)
+	},
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+}
+
+// logTail returns the last lines a container logged, or "" if they cannot be read
+func (r *ClusterScanReconciler) logTail(ctx context.Context, pod *corev1.Pod, container string, previous bool) string {
+	tailLines := logTailLines
+	options := &corev1.PodLogOptions{Container: container, Previous: previous, TailLines: &tailLines}
+	logBytes, err := r.KubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).DoRaw(ctx)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Info("Logs unavailable for failed scan", "pod", pod.Name, "container", container, "error", err.Error())
+		return ""
+	}
+	tail := strings.TrimRight(string(logBytes), "\n")
+	if len(tail) > maxLogTailBytes {
+		// Keep whole lines only
+		tail = tail[len(tail)-maxLogTailBytes:]
+		if newline := strings.Index(tail, "\n"); newline >= 0 {
+			tail = tail[newline+1:]
+		}
+	}
+	return tail
+}
+
+// describeFailure summarizes diagnostics for events and conditions,
+// e.g. "scanner container OOMKilled (exit code 137)"
+func describeFailure(diagnostics *scanv1alpha1.FailureDiagnostics) string {
+	if diagnostics == nil {
+		return ""
+	}
+	description := "pod " + diagnostics.Pod
+	if diagnostics.Container != "" {
+		description = diagnostics.Container + " container"
+	}
+	if diagnostics.Reason != "" {
+		description += " " + diagnostics.Reason
+	}
+	if diagnostics.ExitCode != nil {
+		description += fmt.Sprintf(" (exit code %d)", *diagnostics.ExitCode)
+	}
+	if diagnostics.LogTail != "" {
+		lines := strings.Split(diagnostics.LogTail, "\n")
+		last := lines[len(lines)-1]
+		if len(last) > maxDescribedLine {
+			last = last[:maxDescribedLine] + "..."
+		}
+		description += ": " + last
+	} else if diagnostics.Message != "" {
+		description += ": " + diagnostics.Message
+	}
+	return description
+}
+
+// runFailureMessage describes a failed run together with the diagnostics in its history entry
+func runFailureMessage(clusterScan *scanv1alpha1.ClusterScan, job *batchv1.Job, outcome string) string {
+	message := failureMessage(job, outcome)
+	for _, run := range clusterScan.Status.History {
+		if run.JobName == job.Name && run.Failure != nil {
+			return message + ": " + describeFailure(run.Failure)
+		}
+	}
+	return message
+}
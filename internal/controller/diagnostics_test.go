@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Failure diagnostics", func() {
+	pod := func(statuses ...corev1.ContainerStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job-abcde", Namespace: "default", Labels: map[string]string{"job-name": "nginx-job"}},
+			Status:     corev1.PodStatus{ContainerStatuses: statuses},
+		}
+	}
+	waiting := func(reason, message string) corev1.ContainerState {
+		return corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}}
+	}
+	terminated := func(reason string, exitCode int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}}
+	}
+
+	It("should report how the scanner terminated", func() {
+		diagnostics, previous := failedContainer(pod(corev1.ContainerStatus{Name: ScannerContainer, State: terminated("OOMKilled", 137)}))
+		Expect(previous).To(BeFalse())
+		Expect(diagnostics.Container).To(Equal(ScannerContainer))
+		Expect(diagnostics.Reason).To(Equal("OOMKilled"))
+		Expect(diagnostics.ExitCode).To(HaveValue(Equal(int32(137))))
+		Expect(describeFailure(diagnostics)).To(Equal("scanner container OOMKilled (exit code 137)"))
+	})
+
+	It("should explain a crash looping scanner by its last crash", func() {
+		diagnostics, previous := failedContainer(pod(corev1.ContainerStatus{
+			Name: ScannerContainer, RestartCount: 2,
+			State: waiting("CrashLoopBackOff", "back-off 20s"), LastTerminationState: terminated("Error", 1),
+		}))
+		Expect(previous).To(BeTrue())
+		Expect(diagnostics.Reason).To(Equal("Error"))
+	})
+
+	It("should report containers that never started", func() {
+		diagnostics, _ := failedContainer(pod(corev1.ContainerStatus{
+			Name: ScannerContainer, State: waiting("ImagePullBackOff", `Back-off pulling image "aquasec/trivy:nope"`),
+		}))
+		Expect(diagnostics.Reason).To(Equal("ImagePullBackOff"))
+		Expect(diagnostics.ExitCode).To(BeNil())
+		Expect(describeFailure(diagnostics)).To(ContainSubstring(`Back-off pulling image "aquasec/trivy:nope"`))
+
+		diagnostics, _ = failedContainer(pod(
+			corev1.ContainerStatus{Name: ScannerContainer, State: terminated("Completed", 0)},
+			corev1.ContainerStatus{Name: "uploader", State: waiting("CreateContainerConfigError", `secret "upload" not found`)},
+		))
+		Expect(diagnostics.Container).To(Equal("uploader"))
+		Expect(diagnostics.Reason).To(Equal("CreateContainerConfigError"))
+	})
+
+	It("should fall back to the Pod's own failure", func() {
+		unschedulable := pod()
+		unschedulable.Status.Conditions = []corev1.PodCondition{{
+			Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: "0/3 nodes are available",
+		}}
+		diagnostics, _ := failedContainer(unschedulable)
+		Expect(diagnostics).To(BeNil())
+		Expect(podDiagnostics(unschedulable).Reason).To(Equal("Unschedulable"))
+		Expect(podDiagnostics(pod())).To(BeNil())
+	})
+
+	It("should explain a run stopped at its deadline by why its Pod could not start", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:nope", Target: "nginx:1.25"},
+		}
+		recorder := record.NewFakeRecorder(20)
+		r := &ClusterScanReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(scan).
+				WithStatusSubresource(&scanv1alpha1.ClusterScan{}, &batchv1.Job{}).Build(),
+			Scheme: scheme.Scheme, Recorder: recorder, KubeClient: kubefake.NewSimpleClientset(),
+		}
+		ctx := context.Background()
+		key := client.ObjectKeyFromObject(scan)
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		stalled := pod(corev1.ContainerStatus{
+			Name: ScannerContainer, State: waiting("ImagePullBackOff", `Back-off pulling image "aquasec/trivy:nope"`),
+		})
+		Expect(r.Create(ctx, stalled)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, scan)).To(Succeed())
+		Expect(scan.Status.Phase).To(Equal(PhaseRunning))
+		Expect(meta.FindStatusCondition(scan.Status.Conditions, ConditionReady).Message).To(ContainSubstring("ImagePullBackOff"))
+
+		// The Job controller deletes the Pods of a Job stopped at its deadline
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, client.ObjectKey{Name: "nginx-job", Namespace: "default"}, job)).To(Succeed())
+		Expect(job.Annotations).To(HaveKey(DiagnosticsAnnotation))
+		Expect(r.Delete(ctx, stalled)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonDeadlineExceeded,
+		}}
+		Expect(r.Status().Update(ctx, job)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, scan)).To(Succeed())
+		Expect(scan.Status.Phase).To(Equal(PhaseTimedOut))
+		Expect(scan.Status.History[0].Failure.Reason).To(Equal("ImagePullBackOff"))
+		Expect(meta.FindStatusCondition(scan.Status.Conditions, ConditionReady).Message).To(
+			ContainSubstring(`scanner container ImagePullBackOff: Back-off pulling image "aquasec/trivy:nope"`))
+	})
+
+	It("should watch scan Pods only when their diagnosis changes", func() {
+		before := pod(corev1.ContainerStatus{Name: ScannerContainer, State: waiting("ContainerCreating", "")})
+		after := pod(corev1.ContainerStatus{Name: ScannerContainer, State: waiting("ErrImagePull", "not found")})
+		before.Labels[ScanNameLabel], after.Labels[ScanNameLabel] = "nginx", "nginx"
+		Expect(scanPodStalled.Update(event.UpdateEvent{ObjectOld: before, ObjectNew: after})).To(BeTrue())
+		Expect(scanPodStalled.Update(event.UpdateEvent{ObjectOld: after, ObjectNew: after.DeepCopy()})).To(BeFalse())
+	})
+
+	It("should record the diagnostics and log tail of a failed run", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25"},
+		}
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job", Namespace: "default"},
+			Status: batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{{
+				Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonBackoffLimitExceeded,
+			}}},
+		}
+		failed := pod(corev1.ContainerStatus{Name: ScannerContainer, State: terminated("OOMKilled", 137)})
+		recorder := record.NewFakeRecorder(20)
+		r := &ClusterScanReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(scan, job, failed).Build(),
+			Scheme: scheme.Scheme, Recorder: recorder, KubeClient: kubefake.NewSimpleClientset(),
+		}
+
+		_, err := r.recordRun(context.Background(), scan, job, RunFailed)
+		Expect(err).NotTo(HaveOccurred())
+		run := scan.Status.History[0]
+		Expect(run.Reason).To(Equal(batchv1.JobReasonBackoffLimitExceeded))
+		Expect(run.Failure.Pod).To(Equal("nginx-job-abcde"))
+		Expect(run.Failure.Reason).To(Equal("OOMKilled"))
+		Expect(run.Failure.LogTail).To(Equal("fake logs"))
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("RunFailed"), ContainSubstring("OOMKilled (exit code 137): fake logs"))))
+		Expect(runFailureMessage(scan, job, RunFailed)).To(ContainSubstring("exhausting its retries: scanner container OOMKilled"))
+	})
+})
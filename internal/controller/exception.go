@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// scanException is a ScanException or ClusterScanException that is in effect
+type scanException struct {
+	// Name identifies the exception as Kind/[namespace/]name
+	Name string
+	Spec scanv1alpha1.ScanExceptionSpec
+}
+
+// activeExceptions returns the unexpired ScanExceptions in a ClusterScan's namespace and every
+// unexpired ClusterScanException
+func activeExceptions(ctx context.Context, c client.Reader, namespace string) ([]scanException, error) {
+	now := time.Now()
+	var active []scanException
+
+	namespaced := &scanv1alpha1.ScanExceptionList{}
+	if err := c.List(ctx, namespaced, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("unable to list scan exceptions: %v", err)
+	}
+	for _, exception := range namespaced.Items {
+		if !exceptionExpired(&exception.Spec, now) {
+			active = append(active, scanException{
+				Name: fmt.Sprintf("ScanException/%s/%s", exception.Namespace, exception.Name),
+				Spec: exception.Spec,
+			})
+		}
+	}
+
+	clusterWide := &scanv1alpha1.ClusterScanExceptionList{}
+	if err := c.List(ctx, clusterWide); err != nil {
+		return nil, fmt.Errorf("unable to list cluster scan exceptions: %v", err)
+	}
+	for _, exception := range clusterWide.Items {
+		if !exceptionExpired(&exception.Spec, now) {
+			active = append(active, scanException{
+				Name: "ClusterScanException/" + exception.Name,
+				Spec: exception.Spec,
+			})
+		}
+	}
+	return active, nil
+}
+
+func exceptionExpired(spec *scanv1alpha1.ScanExceptionSpec, now time.Time) bool {
+	return spec.ExpiresAt != nil && !now.Before(spec.ExpiresAt.Time)
+}
+
+// applyExceptions removes accepted findings, returning the rest along with the number
+// suppressed and the sorted names of the exceptions that matched
+func applyExceptions(exceptions []scanException, findings []scanv1alpha1.Finding,
+	scannerType, target string) ([]scanv1alpha1.Finding, int32, []string) {
+	if len(exceptions) == 0 {
+		return findings, 0, nil
+	}
+
+	var kept []scanv1alpha1.Finding
+	var suppressed int32
+	applied := map[string]bool{}
+	for _, f := range findings {
+		matched := false
+		for _, exception := range exceptions {
+			if exception.matches(f, scannerType, target) {
+				applied[exception.Name] = true
+				matched = true
+				break
+			}
+		}
+		if matched {
+			suppressed++
+			continue
+		}
+		kept = append(kept, f)
+	}
+
+	names := make([]string, 0, len(applied))
+	for name := range applied {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return kept, suppressed, names
+}
+
+// matches reports whether a finding satisfies every criterion the exception sets
+func (e scanException) matches(f scanv1alpha1.Finding, scannerType, target string) bool {
+	spec := e.Spec
+	if len(spec.VulnerabilityIDs) > 0 && !containsFold(spec.VulnerabilityIDs, f.ID) {
+		return false
+	}
+	if len(spec.Packages) > 0 && !matchesAnyPattern(spec.Packages, f.Package) {
+		return false
+	}
+	if len(spec.Targets) > 0 && !matchesAnyPattern(spec.Targets, target) {
+		return false
+	}
+	if len(spec.ScannerTypes) > 0 && !containsFold(spec.ScannerTypes, scannerType) {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyPattern matches s against glob patterns in which * matches any run of characters
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		if matched, _ := regexp.MatchString(expr, s); matched {
+			return true
+		}
+	}
+	return false
+}
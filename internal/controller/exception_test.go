@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
+)
+
+var _ = Describe("Scan exceptions", func() {
+	findings := []scanv1alpha1.Finding{
+		{ID: "CVE-2023-0001", Severity: SeverityCritical, Package: "openssl"},
+		{ID: "CVE-2023-0002", Severity: SeverityHigh, Package: "libssl3"},
+		{ID: "CVE-2023-0003", Severity: SeverityHigh, Package: "zlib"},
+	}
+
+	It("should suppress findings matching every populated criterion", func() {
+		exceptions := []scanException{{
+			Name: "ScanException/default/accept-openssl",
+			Spec: scanv1alpha1.ScanExceptionSpec{
+				VulnerabilityIDs: []string{"cve-2023-0001"},
+				Targets:          []string{"nginx:*"},
+				ScannerTypes:     []string{scanner.Trivy},
+			},
+		}}
+
+		kept, suppressed, applied := applyExceptions(exceptions, findings, scanner.Trivy, "nginx:1.25")
+		Expect(suppressed).To(Equal(int32(1)))
+		Expect(kept).To(HaveLen(2))
+		Expect(applied).To(Equal([]string{"ScanException/default/accept-openssl"}))
+
+		_, suppressed, _ = applyExceptions(exceptions, findings, scanner.Trivy, "redis:7")
+		Expect(suppressed).To(BeZero())
+		_, suppressed, _ = applyExceptions(exceptions, findings, scanner.Grype, "nginx:1.25")
+		Expect(suppressed).To(BeZero())
+	})
+
+	It("should match package patterns", func() {
+		exceptions := []scanException{{
+			Name: "ClusterScanException/ssl",
+			Spec: scanv1alpha1.ScanExceptionSpec{Packages: []string{"*ssl*"}},
+		}}
+		kept, suppressed, _ := applyExceptions(exceptions, findings, scanner.Trivy, "")
+		Expect(suppressed).To(Equal(int32(2)))
+		Expect(kept).To(ConsistOf(findings[2]))
+	})
+
+	It("should treat exceptions past their expiry as expired", func() {
+		past := metav1.NewTime(time.Now().Add(-time.Hour))
+		Expect(exceptionExpired(&scanv1alpha1.ScanExceptionSpec{ExpiresAt: &past}, time.Now())).To(BeTrue())
+		Expect(exceptionExpired(&scanv1alpha1.ScanExceptionSpec{}, time.Now())).To(BeFalse())
+	})
+
+	It("should mark an exception expired once and emit an event", func() {
+		past := metav1.NewTime(time.Now().Add(-time.Hour))
+		exception := &scanv1alpha1.ClusterScanException{
+			ObjectMeta: metav1.ObjectMeta{Name: "expired"},
+			Spec:       scanv1alpha1.ScanExceptionSpec{Packages: []string{"zlib"}, Justification: "test", ExpiresAt: &past},
+		}
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(exception).WithStatusSubresource(exception).Build()
+		recorder := record.NewFakeRecorder(5)
+		r := &ClusterScanExceptionReconciler{Client: c, Scheme: scheme.Scheme, Recorder: recorder}
+
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "expired"}}
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &scanv1alpha1.ClusterScanException{}
+		Expect(c.Get(context.Background(), types.NamespacedName{Name: "expired"}, updated)).To(Succeed())
+		Expect(updated.Status.Expired).To(BeTrue())
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(ContainSubstring("ExceptionExpired"))
+	})
+
+	It("should requeue an exception until it expires", func() {
+		future := metav1.NewTime(time.Now().Add(time.Hour))
+		exception := &scanv1alpha1.ScanException{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"},
+			Spec:       scanv1alpha1.ScanExceptionSpec{Packages: []string{"zlib"}, Justification: "test", ExpiresAt: &future},
+		}
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(exception).WithStatusSubresource(exception).Build()
+		r := &ScanExceptionReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(5)}
+
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "pending", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+	})
+
+	It("should re-evaluate existing reports when exceptions are created or deleted", func() {
+		ctx := context.Background()
+		store, err := resultstore.NewFileStore(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		stored, err := store.Put(ctx, resultstore.Object{Namespace: "default", Name: "nginx-job-results"}, []byte(trivyOutput))
+		Expect(err).NotTo(HaveOccurred())
+
+		maxCritical := int32(0)
+		clusterScan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25",
+				FailurePolicy: &scanv1alpha1.FailurePolicy{MaxCritical: &maxCritical},
+			},
+		}
+		report := &scanv1alpha1.ScanReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job", Namespace: "default"},
+			Spec: scanv1alpha1.ScanReportSpec{
+				ScanName: "nginx", JobName: "nginx-job", Target: "nginx:1.25", RawOutput: stored,
+				Scanner: scanv1alpha1.ScannerInfo{Type: scanner.Trivy, Image: "aquasec/trivy:0.50.0"},
+			},
+		}
+		parsed, err := trivyParser{}.Parse([]byte(trivyOutput))
+		Expect(err).NotTo(HaveOccurred())
+		evaluateFindings(clusterScan, report, parsed.Findings, nil)
+		Expect(report.Spec.PolicyViolations).NotTo(BeEmpty())
+
+		exception := &scanv1alpha1.ScanException{
+			ObjectMeta: metav1.ObjectMeta{Name: "accept-libc", Namespace: "default"},
+			Spec:       scanv1alpha1.ScanExceptionSpec{VulnerabilityIDs: []string{"CVE-2021-0001"}, Justification: "test"},
+		}
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(clusterScan, report, exception).WithStatusSubresource(exception).Build()
+		r := &ScanExceptionReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(5), ResultStore: store}
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "accept-libc", Namespace: "default"}}
+		key := types.NamespacedName{Name: "nginx-job", Namespace: "default"}
+
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, key, report)).To(Succeed())
+		Expect(report.Spec.PolicyViolations).To(BeEmpty())
+		Expect(report.Spec.AppliedExceptions).To(Equal([]string{"ScanException/default/accept-libc"}))
+		Expect(report.Spec.Summary.Suppressed).To(Equal(int32(2)))
+
+		// Deleting the exception reports the findings again, from the stored output
+		Expect(c.Delete(ctx, exception)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, key, report)).To(Succeed())
+		Expect(report.Spec.PolicyViolations).NotTo(BeEmpty())
+		Expect(report.Spec.AppliedExceptions).To(BeEmpty())
+	})
+})
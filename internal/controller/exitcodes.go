@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
+)
+
+// exitCodeResults returns what each exit code with a known meaning means for the ClusterScan:
+// the scanner's findings exit code, overridden by spec.exitCodes
+func exitCodeResults(clusterScan *scanv1alpha1.ClusterScan) map[int32]string {
+	results := map[int32]string{}
+	if code, ok := scanner.FindingsExitCode(scanner.DetectType(clusterScan.Spec.Image), scanCommand(clusterScan)); ok {
+		results[code] = scanv1alpha1.ResultFindingsDetected
+	}
+	for _, rule := range clusterScan.Spec.ExitCodes {
+		results[rule.Code] = rule.Result
+	}
+	return results
+}
+
+// exitCodeResult returns what a scanner exit code means, before findings are considered. An
+// unknown exit code is treated like 0, as for results reused from the cache.
+func exitCodeResult(clusterScan *scanv1alpha1.ClusterScan, exitCode *int32) string {
+	var code int32
+	if exitCode != nil {
+		code = *exitCode
+	}
+	if result, ok := exitCodeResults(clusterScan)[code]; ok {
+		return result
+	}
+	if code == 0 {
+		return scanv1alpha1.ResultClean
+	}
+	return scanv1alpha1.ResultScannerError
+}
+
+// classifyRun returns the result of a run that produced output: its exit code's meaning, with
+// Clean runs that reported findings counted as FindingsDetected
+func classifyRun(clusterScan *scanv1alpha1.ClusterScan, exitCode *int32, summary *scanv1alpha1.VulnerabilitySummary) string {
+	result := exitCodeResult(clusterScan, exitCode)
+	if result == scanv1alpha1.ResultClean && summary != nil &&
+		summary.Critical+summary.High+summary.Medium+summary.Low+summary.Unknown > 0 {
+		return scanv1alpha1.ResultFindingsDetected
+	}
+	return result
+}
+
+// completedExitCodes returns the non-zero exit codes of completed scans, those meaning Clean or
+// FindingsDetected, sorted
+func completedExitCodes(clusterScan *scanv1alpha1.ClusterScan) []int32 {
+	var codes []int32
+	for code, result := range exitCodeResults(clusterScan) {
+		if code != 0 && result != scanv1alpha1.ResultScannerError {
+			codes = append(codes, code)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// applyExitCodePolicy stops retrying scanners whose non-zero exit code means the scan completed,
+// e.g. with findings. Pod failure policies need Pods that are never restarted in place, so
+// retries then run in new Pods. Jobs failed by the policy are collected as completed runs, see
+// jobOutcome.
+func applyExitCodePolicy(clusterScan *scanv1alpha1.ClusterScan, spec *batchv1.JobSpec) {
+	codes := completedExitCodes(clusterScan)
+	if len(codes) == 0 {
+		return
+	}
+	container := ScannerContainer
+	spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	spec.PodFailurePolicy = &batchv1.PodFailurePolicy{Rules: []batchv1.PodFailurePolicyRule{{
+		Action: batchv1.PodFailurePolicyActionFailJob,
+		OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+			ContainerName: &container,
+			Operator:      batchv1.PodFailurePolicyOnExitCodesOpIn,
+			Values:        codes,
+		},
+	}}}
+}
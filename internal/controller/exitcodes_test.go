@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Exit code semantics", func() {
+	scan := func(command ...string) *scanv1alpha1.ClusterScan {
+		return &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25", Command: command},
+		}
+	}
+	code := func(c int32) *int32 { return &c }
+
+	It("should classify runs by exit code and findings", func() {
+		clusterScan := scan("trivy", "image", "--exit-code", "1", "--format", "json", "nginx:1.25")
+		findings := &scanv1alpha1.VulnerabilitySummary{High: 2}
+
+		Expect(classifyRun(clusterScan, code(0), nil)).To(Equal(scanv1alpha1.ResultClean))
+		Expect(classifyRun(clusterScan, code(0), findings)).To(Equal(scanv1alpha1.ResultFindingsDetected))
+		Expect(classifyRun(clusterScan, code(1), findings)).To(Equal(scanv1alpha1.ResultFindingsDetected))
+		Expect(classifyRun(clusterScan, code(2), nil)).To(Equal(scanv1alpha1.ResultScannerError))
+		Expect(classifyRun(scan("trivy", "image", "nginx:1.25"), code(1), nil)).To(Equal(scanv1alpha1.ResultScannerError))
+		Expect(completedExitCodes(scan("trivy", "image", "--exit-code=5", "nginx:1.25"))).To(Equal([]int32{5}))
+
+		grype := scan("grype", "nginx:1.25", "-o", "json", "--fail-on", "high")
+		grype.Spec.Image = "anchore/grype:v0.80.0"
+		Expect(classifyRun(grype, code(1), findings)).To(Equal(scanv1alpha1.ResultFindingsDetected))
+		Expect(completedExitCodes(grype)).To(Equal([]int32{1}))
+		grype.Spec.Command = []string{"grype", "nginx:1.25", "-o", "json", "-f=critical"}
+		Expect(completedExitCodes(grype)).To(Equal([]int32{1}))
+		grype.Spec.Command = []string{"grype", "nginx:1.25", "-o", "json"}
+		Expect(classifyRun(grype, code(1), nil)).To(Equal(scanv1alpha1.ResultScannerError))
+
+		clusterScan.Spec.ExitCodes = []scanv1alpha1.ExitCodeRule{
+			{Code: 1, Result: scanv1alpha1.ResultScannerError},
+			{Code: 3, Result: scanv1alpha1.ResultFindingsDetected},
+			{Code: 4, Result: scanv1alpha1.ResultClean},
+		}
+		Expect(classifyRun(clusterScan, code(1), findings)).To(Equal(scanv1alpha1.ResultScannerError))
+		Expect(classifyRun(clusterScan, code(4), nil)).To(Equal(scanv1alpha1.ResultClean))
+		Expect(completedExitCodes(clusterScan)).To(Equal([]int32{3, 4}))
+	})
+
+	It("should fail the Job instead of retrying the exit codes of completed scans", func() {
+		spec := scanJobSpec(scan())
+		Expect(spec.PodFailurePolicy).To(BeNil())
+		Expect(spec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyOnFailure))
+
+		spec = scanJobSpec(scan("trivy", "image", "--exit-code", "1", "nginx:1.25"))
+		Expect(spec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyNever))
+		Expect(spec.PodFailurePolicy.Rules).To(HaveLen(1))
+		rule := spec.PodFailurePolicy.Rules[0]
+		Expect(rule.Action).To(Equal(batchv1.PodFailurePolicyActionFailJob))
+		Expect(rule.OnExitCodes.ContainerName).To(HaveValue(Equal(ScannerContainer)))
+		Expect(rule.OnExitCodes.Values).To(Equal([]int32{1}))
+
+		clean := scan()
+		clean.Spec.ExitCodes = []scanv1alpha1.ExitCodeRule{{Code: 4, Result: scanv1alpha1.ResultClean}}
+		spec = scanJobSpec(clean)
+		Expect(spec.PodFailurePolicy.Rules[0].OnExitCodes.Values).To(Equal([]int32{4}))
+	})
+
+	It("should collect a Job failed by the findings exit code as a completed scan", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		clusterScan := scan("trivy", "image", "--exit-code", "1", "--format", "json", "nginx:1.25")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(clusterScan).
+			WithStatusSubresource(&scanv1alpha1.ClusterScan{}, &batchv1.Job{}).Build()
+		r := &ClusterScanReconciler{
+			Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20),
+			KubeClient: kubefake.NewSimpleClientset(),
+		}
+		ctx := context.Background()
+		key := client.ObjectKeyFromObject(clusterScan)
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, client.ObjectKey{Name: "nginx-job", Namespace: "default"}, job)).To(Succeed())
+		job.Status.Failed = 1
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonPodFailurePolicy,
+		}}
+		Expect(r.Status().Update(ctx, job)).To(Succeed())
+		Expect(r.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job-abcde", Namespace: "default", Labels: map[string]string{"job-name": "nginx-job"}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name: ScannerContainer, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+			}}},
+		})).To(Succeed())
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, clusterScan)).To(Succeed())
+		Expect(clusterScan.Status.Phase).To(Equal(PhaseCompleted))
+		Expect(clusterScan.Status.ScanExitCode).To(HaveValue(Equal(int32(1))))
+		Expect(clusterScan.Status.ScanResult).To(Equal(scanv1alpha1.ResultFindingsDetected))
+		Expect(clusterScan.Status.History[0].Outcome).To(Equal(RunSucceeded))
+		Expect(clusterScan.Status.History[0].Result).To(Equal(scanv1alpha1.ResultFindingsDetected))
+	})
+})
@@ -0,0 +1,326 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// Outcomes recorded for finished runs
+const (
+	RunSucceeded = "Succeeded"
+	RunFailed    = "Failed"
+
+	// RunTimedOut means the run was stopped when it exceeded the scan timeout
+	RunTimedOut = "TimedOut"
+)
+
+// CollectedLabel marks scan Jobs whose outcome has already been recorded in the ClusterScan history
+const CollectedLabel = "scan.ahmali3.github.io/collected"
+
+const (
+	defaultSuccessfulHistoryLimit int32 = 3
+	defaultFailedHistoryLimit     int32 = 1
+)
+
+// historyLimits returns how many successful and failed runs to retain
+func historyLimits(clusterScan *scanv1alpha1.ClusterScan) (successful, failed int32) {
+	successful, failed = defaultSuccessfulHistoryLimit, defaultFailedHistoryLimit
+	if limit := clusterScan.Spec.HistoryLimit; limit != nil {
+		if limit.Successful != nil {
+			successful = *limit.Successful
+		}
+		if limit.Failed != nil {
+			failed = *limit.Failed
+		}
+	}
+	return successful, failed
+}
+
+// jobOutcome reports whether a Job has finished and, if so, whether it succeeded. A Job
+// stopped at its deadline may not have a failed Pod, so its Failed condition is checked too.
+// Jobs failed by their pod failure policy ended with an exit code of a completed scan, see
+// applyExitCodePolicy, and succeeded as scans.
+func jobOutcome(job *batchv1.Job) (string, bool) {
+	failure := jobFailure(job)
+	switch {
+	case job.Status.Succeeded > 0:
+		return RunSucceeded, true
+	case failure != nil && failure.Reason == batchv1.JobReasonPodFailurePolicy:
+		return RunSucceeded, true
+	case failure != nil && failure.Reason == batchv1.JobReasonDeadlineExceeded:
+		return RunTimedOut, true
+	case job.Status.Failed > 0 || failure != nil:
+		return RunFailed, true
+	default:
+		return "", false
+	}
+}
+
+// jobFinishTime returns when a finished Job completed. Failed Jobs have no completion time,
+// so the transition time of their Failed condition is used instead.
+func jobFinishTime(job *batchv1.Job) *metav1.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			finishedAt := condition.LastTransitionTime
+			return &finishedAt
+		}
+	}
+	return nil
+}
+
+// needsCollection reports whether a finished Job has yet to be recorded
+func needsCollection(clusterScan *scanv1alpha1.ClusterScan, job *batchv1.Job) bool {
+	if job.Labels[CollectedLabel] == "true" {
+		return false
+	}
+	for _, run := range clusterScan.Status.History {
+		if run.JobName == job.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// recordRun stores the results of a finished Job and adds it to the ClusterScan history,
+// returning the run's ScanReport if one was produced.
+// The caller persists the status and then marks the Job with markCollected.
+func (r *ClusterScanReconciler) recordRun(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	job *batchv1.Job, outcome string) (*scanv1alpha1.ScanReport, error) {
+	var report *scanv1alpha1.ScanReport
+	run := scanv1alpha1.ScanRun{
+		JobName:        job.Name,
+		Outcome:        outcome,
+		StartTime:      job.Status.StartTime,
+		CompletionTime: jobFinishTime(job),
+	}
+
+	pods, err := r.listJobPods(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	run.Attempts = countAttempts(pods)
+
+	if outcome == RunSucceeded {
+		report, err = r.captureAndStoreScanResults(ctx, clusterScan, job, pods)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store results: %v", err)
+		}
+		if report != nil {
+			run.Report = report.Name
+			run.ExitCode = report.Spec.ExitCode
+			run.Result = report.Spec.Result
+			run.PolicyViolated = len(report.Spec.PolicyViolations) > 0
+		}
+		r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "RunSucceeded", "Scan run %s succeeded", job.Name)
+	} else {
+		if failure := jobFailure(job); failure != nil {
+			run.Reason = failure.Reason
+		}
+		run.Failure = r.failureDiagnostics(ctx, job, pods)
+		run.Result = scanv1alpha1.ResultScannerError
+		clusterScan.Status.ScanResult = scanv1alpha1.ResultScannerError
+		eventReason := "RunFailed"
+		if outcome == RunTimedOut {
+			eventReason = "RunTimedOut"
+		}
+		message := failureMessage(job, outcome)
+		if run.Failure != nil {
+			message += ": " + describeFailure(run.Failure)
+		}
+		r.Recorder.Event(clusterScan, corev1.EventTypeWarning, eventReason, message)
+	}
+
+	clusterScan.Status.LastJobName = job.Name
+	if run.CompletionTime != nil {
+		clusterScan.Status.LastRunTime = run.CompletionTime
+	}
+
+	successful, failed := historyLimits(clusterScan)
+	clusterScan.Status.History = trimHistory(append([]scanv1alpha1.ScanRun{run}, clusterScan.Status.History...), successful, failed)
+	return report, nil
+}
+
+// collectScheduledRuns records every finished Job spawned by the ClusterScan's CronJob or a run-now
+// request, oldest first. It returns the Jobs that were newly recorded and the newest unfinished Job.
+func (r *ClusterScanReconciler) collectScheduledRuns(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan) (
+	[]*batchv1.Job, *batchv1.Job, error) {
+	jobList := &batchv1.JobList{}
+	if err := r.List(ctx, jobList, client.InNamespace(clusterScan.Namespace),
+		client.MatchingLabels{ScanNameLabel: clusterScan.Name}); err != nil {
+		return nil, nil, fmt.Errorf("unable to list jobs: %v", err)
+	}
+
+	sort.Slice(jobList.Items, func(i, j int) bool {
+		return jobList.Items[i].CreationTimestamp.Before(&jobList.Items[j].CreationTimestamp)
+	})
+
+	var collected []*batchv1.Job
+	var active *batchv1.Job
+	for i := range jobList.Items {
+		job := &jobList.Items[i]
+		outcome, finished := jobOutcome(job)
+		if !finished {
+			if _, err := r.observeActiveJob(ctx, job); err != nil {
+				return nil, nil, err
+			}
+			active = job
+			continue
+		}
+		if !needsCollection(clusterScan, job) {
+			continue
+		}
+		if _, err := r.recordRun(ctx, clusterScan, job, outcome); err != nil {
+			return nil, nil, err
+		}
+		collected = append(collected, job)
+	}
+	return collected, active, nil
+}
+
+// setScheduledRunConditions reflects the outcome of the most recent scheduled run in the
+// Ready and LastRunSucceeded conditions
+func setScheduledRunConditions(clusterScan *scanv1alpha1.ClusterScan) {
+	if len(clusterScan.Status.History) == 0 {
+		meta.SetStatusCondition(&clusterScan.Status.Conditions, metav1.Condition{
+			Type: ConditionLastRunSucceeded, Status: metav1.ConditionUnknown, Reason: "NoRunsYet",
+			Message: "No scheduled run has finished yet",
+		})
+		meta.SetStatusCondition(&clusterScan.Status.Conditions, metav1.Condition{
+			Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Scheduled",
+			Message: fmt.Sprintf("Scan scheduled: %s", clusterScan.Spec.Schedule),
+		})
+		return
+	}
+
+	last := clusterScan.Status.History[0]
+	if last.Outcome == RunSucceeded {
+		meta.SetStatusCondition(&clusterScan.Status.Conditions, metav1.Condition{
+			Type: ConditionLastRunSucceeded, Status: metav1.ConditionTrue, Reason: "RunSucceeded",
+			Message: fmt.Sprintf("Scheduled run %s succeeded", last.JobName),
+		})
+		meta.SetStatusCondition(&clusterScan.Status.Conditions, metav1.Condition{
+			Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Scheduled",
+			Message: fmt.Sprintf("Scan scheduled: %s", clusterScan.Spec.Schedule),
+		})
+		return
+	}
+
+	reason, ended := "RunFailed", "failed"
+	if last.Outcome == RunTimedOut {
+		reason, ended = "RunTimedOut", "timed out"
+	} else if last.Reason != "" {
+		ended = "failed: " + last.Reason
+	}
+	meta.SetStatusCondition(&clusterScan.Status.Conditions, metav1.Condition{
+		Type: ConditionLastRunSucceeded, Status: metav1.ConditionFalse, Reason: reason,
+		Message: fmt.Sprintf("Scheduled run %s %s", last.JobName, ended),
+	})
+	meta.SetStatusCondition(&clusterScan.Status.Conditions, metav1.Condition{
+		Type: ConditionReady, Status: metav1.ConditionFalse, Reason: reason,
+		Message: fmt.Sprintf("Last scheduled run %s %s", last.JobName, ended),
+	})
+}
+
+// markCollected labels Jobs whose runs are recorded so they are not collected again
+// once they fall out of the status history, and sets their configured TTL now that their
+// results are stored
+func (r *ClusterScanReconciler) markCollected(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	jobs ...*batchv1.Job) error {
+	ttl := r.jobTTL(clusterScan)
+	for _, job := range jobs {
+		patch := client.MergeFrom(job.DeepCopy())
+		if job.Labels == nil {
+			job.Labels = map[string]string{}
+		}
+		job.Labels[CollectedLabel] = "true"
+		if ttl != nil {
+			job.Spec.TTLSecondsAfterFinished = ttl
+		}
+		if err := r.Patch(ctx, job, patch); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to mark job %s as collected: %v", job.Name, err)
+		}
+	}
+	return nil
+}
+
+// trimHistory keeps the newest successful and failed runs up to their respective limits
+func trimHistory(history []scanv1alpha1.ScanRun, successful, failed int32) []scanv1alpha1.ScanRun {
+	var kept []scanv1alpha1.ScanRun
+	var succeededCount, failedCount int32
+	for _, run := range history {
+		if run.Outcome == RunSucceeded {
+			if succeededCount >= successful {
+				continue
+			}
+			succeededCount++
+		} else {
+			if failedCount >= failed {
+				continue
+			}
+			failedCount++
+		}
+		kept = append(kept, run)
+	}
+	return kept
+}
+
+// pruneReports deletes ScanReports, and their raw output, for runs no longer in the history.
+// The latest report and the report of every selector target and node are always kept so the
+// status never points at a deleted object.
+func (r *ClusterScanReconciler) pruneReports(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	retained := map[string]bool{clusterScan.Status.LatestReport: true}
+	for _, run := range clusterScan.Status.History {
+		if run.Report != "" {
+			retained[run.Report] = true
+		}
+	}
+	for _, target := range clusterScan.Status.Targets {
+		if target.Report != "" {
+			retained[target.Report] = true
+		}
+	}
+	for _, node := range clusterScan.Status.Nodes {
+		if node.Report != "" {
+			retained[node.Report] = true
+		}
+	}
+
+	reportList := &scanv1alpha1.ScanReportList{}
+	if err := r.List(ctx, reportList, client.InNamespace(clusterScan.Namespace),
+		client.MatchingLabels{ScanNameLabel: clusterScan.Name}); err != nil {
+		return fmt.Errorf("unable to list scan reports: %v", err)
+	}
+
+	for i := range reportList.Items {
+		report := &reportList.Items[i]
+		if retained[report.Name] {
+			continue
+		}
+		if err := r.Delete(ctx, report); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete ScanReport %s: %v", report.Name, err)
+		}
+		if report.Spec.RawOutput != nil {
+			// Raw output may live in a store the manager is no longer configured for; don't block on it
+			if err := r.resultStore().Delete(ctx, report.Spec.RawOutput.URI); err != nil {
+				log.Error(err, "Failed to delete raw scan output", "uri", report.Spec.RawOutput.URI)
+			}
+		}
+		log.Info("Pruned scan report beyond history limit", "report", report.Name)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Scan history", func() {
+	It("should default history limits to match CronJob defaults", func() {
+		successful, failed := historyLimits(&scanv1alpha1.ClusterScan{})
+		Expect(successful).To(Equal(int32(3)))
+		Expect(failed).To(Equal(int32(1)))
+	})
+
+	It("should honour configured history limits", func() {
+		five, zero := int32(5), int32(0)
+		scan := &scanv1alpha1.ClusterScan{Spec: scanv1alpha1.ClusterScanSpec{
+			HistoryLimit: &scanv1alpha1.HistoryLimit{Successful: &five, Failed: &zero},
+		}}
+		successful, failed := historyLimits(scan)
+		Expect(successful).To(Equal(int32(5)))
+		Expect(failed).To(BeZero())
+	})
+
+	It("should keep the newest runs of each outcome", func() {
+		history := []scanv1alpha1.ScanRun{
+			{JobName: "run-6", Outcome: RunSucceeded},
+			{JobName: "run-5", Outcome: RunFailed},
+			{JobName: "run-4", Outcome: RunSucceeded},
+			{JobName: "run-3", Outcome: RunSucceeded},
+			{JobName: "run-2", Outcome: RunFailed},
+			{JobName: "run-1", Outcome: RunSucceeded},
+		}
+		trimmed := trimHistory(history, 2, 1)
+		var names []string
+		for _, run := range trimmed {
+			names = append(names, run.JobName)
+		}
+		Expect(names).To(Equal([]string{"run-6", "run-5", "run-4"}))
+	})
+
+	It("should skip Jobs that were already collected", func() {
+		scan := &scanv1alpha1.ClusterScan{Status: scanv1alpha1.ClusterScanStatus{
+			History: []scanv1alpha1.ScanRun{{JobName: "recorded", Outcome: RunSucceeded}},
+		}}
+		Expect(needsCollection(scan, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "recorded"}})).To(BeFalse())
+		Expect(needsCollection(scan, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name: "pruned", Labels: map[string]string{CollectedLabel: "true"},
+		}})).To(BeFalse())
+		Expect(needsCollection(scan, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "new"}})).To(BeTrue())
+	})
+
+	It("should use the Failed condition time for failed Jobs", func() {
+		failedAt := metav1.NewTime(metav1.Now().Add(-time.Minute).Truncate(time.Second))
+		job := &batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+			Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: failedAt,
+		}}}}
+		Expect(jobFinishTime(job)).To(Equal(&failedAt))
+		Expect(jobFinishTime(&batchv1.Job{})).To(BeNil())
+	})
+
+	It("should reflect the latest scheduled run in the conditions", func() {
+		scan := &scanv1alpha1.ClusterScan{Spec: scanv1alpha1.ClusterScanSpec{Schedule: "0 2 * * *"}}
+		setScheduledRunConditions(scan)
+		Expect(meta.IsStatusConditionPresentAndEqual(scan.Status.Conditions, ConditionLastRunSucceeded, metav1.ConditionUnknown)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(scan.Status.Conditions, ConditionReady)).To(BeTrue())
+
+		scan.Status.History = []scanv1alpha1.ScanRun{
+			{JobName: "run-2", Outcome: RunFailed},
+			{JobName: "run-1", Outcome: RunSucceeded},
+		}
+		setScheduledRunConditions(scan)
+		Expect(meta.IsStatusConditionFalse(scan.Status.Conditions, ConditionLastRunSucceeded)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(scan.Status.Conditions, ConditionReady)).To(BeTrue())
+
+		scan.Status.History = append([]scanv1alpha1.ScanRun{{JobName: "run-3", Outcome: RunSucceeded}}, scan.Status.History...)
+		setScheduledRunConditions(scan)
+		Expect(meta.IsStatusConditionTrue(scan.Status.Conditions, ConditionLastRunSucceeded)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(scan.Status.Conditions, ConditionReady)).To(BeTrue())
+	})
+})
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
+)
+
+// kubeBenchHostPaths are the host directories kube-bench reads configuration and file permissions from
+var kubeBenchHostPaths = []struct{ Name, Path string }{
+	{"etc-kubernetes", "/etc/kubernetes"},
+	{"var-lib-kubelet", "/var/lib/kubelet"},
+	{"etc-systemd", "/etc/systemd"},
+}
+
+// applyHostAccess grants the scanner container of a kube-bench scan Pod the host access of the
+// ClusterScan's profile. Host directories are mounted read-only at their host paths, which is
+// where kube-bench looks. Other scanners never get host access, even if the webhook was bypassed.
+func applyHostAccess(clusterScan *scanv1alpha1.ClusterScan, pod *corev1.PodSpec) {
+	access := clusterScan.Spec.HostAccess
+	if access == nil || scanner.DetectType(clusterScan.Spec.Image) != scanner.KubeBench {
+		return
+	}
+
+	pod.HostPID = true
+	container := scannerContainer(pod)
+	for _, dir := range kubeBenchHostPaths {
+		pod.Volumes = append(pod.Volumes, corev1.Volume{
+			Name:         dir.Name,
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: dir.Path}},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name: dir.Name, MountPath: dir.Path, ReadOnly: true,
+		})
+	}
+
+	// Like a DaemonSet, run on tainted nodes such as the control plane
+	pod.Tolerations = append(pod.Tolerations, corev1.Toleration{Operator: corev1.TolerationOpExists})
+	if access.NodeName != "" {
+		pod.NodeName = access.NodeName
+	}
+}
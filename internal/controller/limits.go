@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+const (
+	defaultScanTimeout       = time.Hour
+	defaultMaxRetries  int32 = 3
+)
+
+// scanTimeout returns how long a scan run may take
+func scanTimeout(clusterScan *scanv1alpha1.ClusterScan) time.Duration {
+	if clusterScan.Spec.Timeout != nil {
+		return clusterScan.Spec.Timeout.Duration
+	}
+	return defaultScanTimeout
+}
+
+// scanJobSpec builds the spec shared by one-off, scheduled and fanned-out scan Jobs. The
+// deadline covers the whole run, so a scan stuck pulling an image is stopped too.
+func scanJobSpec(clusterScan *scanv1alpha1.ClusterScan) batchv1.JobSpec {
+	deadline := int64(math.Ceil(scanTimeout(clusterScan).Seconds()))
+	retries := defaultMaxRetries
+	if clusterScan.Spec.MaxRetries != nil {
+		retries = *clusterScan.Spec.MaxRetries
+	}
+	spec := batchv1.JobSpec{
+		ActiveDeadlineSeconds: &deadline,
+		BackoffLimit:          &retries,
+		Template:              scanPodTemplate(clusterScan),
+	}
+	applyExitCodePolicy(clusterScan, &spec)
+	return spec
+}
+
+// jobFailure returns the condition recording why a Job failed, or nil if it has not failed
+func jobFailure(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// failureMessage describes why a run ended unsuccessfully for events and conditions
+func failureMessage(job *batchv1.Job, outcome string) string {
+	failure := jobFailure(job)
+	switch {
+	case outcome == RunTimedOut && job.Spec.ActiveDeadlineSeconds != nil:
+		return fmt.Sprintf("Scan run %s did not finish within %s", job.Name,
+			time.Duration(*job.Spec.ActiveDeadlineSeconds)*time.Second)
+	case outcome == RunTimedOut:
+		return fmt.Sprintf("Scan run %s did not finish within its deadline", job.Name)
+	case failure != nil && failure.Reason == batchv1.JobReasonBackoffLimitExceeded:
+		return fmt.Sprintf("Scan run %s failed after exhausting its retries", job.Name)
+	case failure != nil && failure.Message != "":
+		return fmt.Sprintf("Scan run %s failed: %s", job.Name, failure.Message)
+	default:
+		return fmt.Sprintf("Scan run %s failed", job.Name)
+	}
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Scan timeouts and retries", func() {
+	scan := func() *scanv1alpha1.ClusterScan {
+		return &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25"},
+		}
+	}
+
+	It("should bound every scan Job by the timeout and retry limit", func() {
+		clusterScan := scan()
+		spec := scanJobSpec(clusterScan)
+		Expect(spec.ActiveDeadlineSeconds).To(HaveValue(Equal(int64(3600))))
+		Expect(spec.BackoffLimit).To(HaveValue(Equal(int32(3))))
+
+		retries := int32(0)
+		clusterScan.Spec.Timeout = &metav1.Duration{Duration: 90 * time.Second}
+		clusterScan.Spec.MaxRetries = &retries
+		r := &ClusterScanReconciler{Scheme: scheme.Scheme}
+		for _, job := range []*batchv1.Job{r.constructJob(clusterScan, "nginx-job"), r.constructTargetJob(clusterScan, "nginx-1", "redis:7")} {
+			Expect(job.Spec.ActiveDeadlineSeconds).To(HaveValue(Equal(int64(90))))
+			Expect(job.Spec.BackoffLimit).To(HaveValue(BeZero()))
+		}
+	})
+
+	It("should classify finished Jobs by their Failed condition", func() {
+		failed := func(reason string) *batchv1.Job {
+			return &batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: reason},
+			}}}
+		}
+		outcome, finished := jobOutcome(failed(batchv1.JobReasonDeadlineExceeded))
+		Expect(finished).To(BeTrue())
+		Expect(outcome).To(Equal(RunTimedOut))
+
+		outcome, _ = jobOutcome(failed(batchv1.JobReasonBackoffLimitExceeded))
+		Expect(outcome).To(Equal(RunFailed))
+		Expect(failureMessage(failed(batchv1.JobReasonBackoffLimitExceeded), outcome)).To(ContainSubstring("exhausting its retries"))
+	})
+
+	It("should report a run stopped at its deadline as TimedOut", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		clusterScan := scan()
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(clusterScan).
+			WithStatusSubresource(&scanv1alpha1.ClusterScan{}, &batchv1.Job{}).Build()
+		recorder := record.NewFakeRecorder(20)
+		r := &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme, Recorder: recorder}
+		ctx := context.Background()
+		key := client.ObjectKeyFromObject(clusterScan)
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, client.ObjectKey{Name: "nginx-job", Namespace: "default"}, job)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonDeadlineExceeded,
+			Message: "Job was active longer than specified deadline",
+		}}
+		Expect(r.Status().Update(ctx, job)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, clusterScan)).To(Succeed())
+		Expect(clusterScan.Status.Phase).To(Equal(PhaseTimedOut))
+		ready := meta.FindStatusCondition(clusterScan.Status.Conditions, ConditionReady)
+		Expect(ready.Reason).To(Equal(batchv1.JobReasonDeadlineExceeded))
+		Expect(ready.Message).To(ContainSubstring("did not finish within 1h0m0s"))
+		Expect(clusterScan.Status.History).To(HaveLen(1))
+		Expect(clusterScan.Status.History[0].Outcome).To(Equal(RunTimedOut))
+		Expect(clusterScan.Status.History[0].Reason).To(Equal(batchv1.JobReasonDeadlineExceeded))
+		Expect(recorder.Events).To(Receive(ContainSubstring("JobCreated")))
+		Expect(recorder.Events).To(Receive(ContainSubstring("RunTimedOut")))
+	})
+})
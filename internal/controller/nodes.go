@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// NodeAnnotation records the node a fanned-out scan Job runs on
+const NodeAnnotation = "scan.ahmali3.github.io/node"
+
+// fansOutToNodes reports whether the ClusterScan runs one scan Pod per node
+func fansOutToNodes(clusterScan *scanv1alpha1.ClusterScan) bool {
+	return clusterScan.Spec.PerNode != nil || (clusterScan.Spec.HostAccess != nil && clusterScan.Spec.HostAccess.AllNodes)
+}
+
+// nodeSelector returns the selector of the nodes a fanned-out scan runs on
+func nodeSelector(clusterScan *scanv1alpha1.ClusterScan) (labels.Selector, error) {
+	if clusterScan.Spec.PerNode == nil || clusterScan.Spec.PerNode.NodeSelector == nil {
+		return labels.Everything(), nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(clusterScan.Spec.PerNode.NodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node selector: %v", err)
+	}
+	return selector, nil
+}
+
+// jobNode returns the node a Job's scan was pinned to, or ""
+func jobNode(job *batchv1.Job) string {
+	if node, ok := job.Annotations[NodeAnnotation]; ok {
+		return node
+	}
+	return job.Spec.Template.Spec.NodeName
+}
+
+// nodeJobName derives a stable Job name for a node, since node names may be too long for one
+func nodeJobName(clusterScan *scanv1alpha1.ClusterScan, node string) string {
+	sum := sha256.Sum256([]byte(node))
+	return fmt.Sprintf("%s-node-%s", clusterScan.Name, hex.EncodeToString(sum[:])[:10])
+}
+
+// discoverNodes lists the selected Ready nodes, sorted by name. Pods pinned to other nodes would never run.
+func (r *ClusterScanReconciler) discoverNodes(ctx context.Context, selector labels.Selector) ([]string, error) {
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %v", err)
+	}
+	var names []string
+	for _, node := range nodes.Items {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+				names = append(names, node.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// reconcileNodes runs one scan Job pinned to each selected Ready node, discovered on the first
+// reconcile, and aggregates their results into the ClusterScan status
+func (r *ClusterScanReconciler) reconcileNodes(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan) (ctrl.Result, error) {
+	if len(clusterScan.Status.Nodes) == 0 && (clusterScan.Status.Phase == "" || clusterScan.Status.Phase == PhasePending) {
+		selector, err := nodeSelector(clusterScan)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		names, err := r.discoverNodes(ctx, selector)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		for _, name := range names {
+			clusterScan.Status.Nodes = append(clusterScan.Status.Nodes, scanv1alpha1.NodeStatus{Name: name, Phase: PhasePending})
+		}
+		r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "NodesDiscovered", "Scanning %d nodes", len(names))
+	}
+
+	jobList := &batchv1.JobList{}
+	if err := r.List(ctx, jobList, client.InNamespace(clusterScan.Namespace),
+		client.MatchingLabels{ScanNameLabel: clusterScan.Name}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to list jobs: %v", err)
+	}
+	jobs := map[string]*batchv1.Job{}
+	for i := range jobList.Items {
+		jobs[jobList.Items[i].Name] = &jobList.Items[i]
+	}
+
+	var collected []*batchv1.Job
+	for i := range clusterScan.Status.Nodes {
+		node := &clusterScan.Status.Nodes[i]
+		job, ok := jobs[nodeJobName(clusterScan, node.Name)]
+		if !ok {
+			if node.Phase != PhasePending {
+				continue
+			}
+			job = r.constructNodeJob(clusterScan, nodeJobName(clusterScan, node.Name), node.Name)
+			if err := controllerutil.SetControllerReference(clusterScan, job, r.Scheme); err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := r.Create(ctx, job); client.IgnoreAlreadyExists(err) != nil {
+				return ctrl.Result{}, err
+			}
+			node.JobName = job.Name
+			node.Phase = PhaseRunning
+			continue
+		}
+
+		node.JobName = job.Name
+		outcome, finished := jobOutcome(job)
+		if !finished {
+			if _, err := r.observeActiveJob(ctx, job); err != nil {
+				return ctrl.Result{}, err
+			}
+			node.Phase = PhaseRunning
+			continue
+		}
+		if !needsCollection(clusterScan, job) {
+			continue
+		}
+		report, err := r.recordRun(ctx, clusterScan, job, outcome)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		collected = append(collected, job)
+		node.Phase = PhaseCompleted
+		if outcome != RunSucceeded {
+			node.Phase = PhaseFailed
+			r.Recorder.Eventf(clusterScan, corev1.EventTypeWarning, "NodeScanFailed", "Scan of node %s failed", node.Name)
+		}
+		if report != nil {
+			summary := report.Spec.Summary
+			node.Report = report.Name
+			node.Summary = &summary
+			if len(report.Spec.PolicyViolations) > 0 {
+				node.Phase = PhasePolicyViolated
+			}
+		}
+	}
+
+	aggregateNodes(clusterScan)
+	clusterScan.Status.ObservedGeneration = clusterScan.Generation
+
+	if err := r.Status().Update(ctx, clusterScan); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.markCollected(ctx, clusterScan, collected...); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.pruneReports(ctx, clusterScan); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// constructNodeJob builds the scan Job pinned to one node. Host access scans set nodeName, which
+// bypasses the scheduler so the Pod runs even on cordoned nodes. Other scans are pinned with node
+// affinity, like DaemonSet Pods, so taints and resource requests are still honoured.
+func (r *ClusterScanReconciler) constructNodeJob(clusterScan *scanv1alpha1.ClusterScan, name, node string) *batchv1.Job {
+	job := r.constructJob(clusterScan, name)
+	job.Annotations = map[string]string{NodeAnnotation: node}
+	pod := &job.Spec.Template.Spec
+	if clusterScan.Spec.HostAccess != nil {
+		pod.NodeName = node
+		return job
+	}
+	pinToNode(pod, node)
+	return job
+}
+
+// pinToNode requires the Pod to be scheduled onto node, in addition to any node affinity it has
+func pinToNode(pod *corev1.PodSpec, node string) {
+	requirement := corev1.NodeSelectorRequirement{
+		Key: metav1.ObjectNameField, Operator: corev1.NodeSelectorOpIn, Values: []string{node},
+	}
+	if pod.Affinity == nil {
+		pod.Affinity = &corev1.Affinity{}
+	}
+	if pod.Affinity.NodeAffinity == nil {
+		pod.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := pod.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		pod.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchFields: []corev1.NodeSelectorRequirement{requirement}}},
+		}
+		return
+	}
+	// Terms are ORed, so the node is required in each of them
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		term.MatchFields = append(term.MatchFields, requirement)
+	}
+}
+
+// aggregateNodes sums the per-node results into the ClusterScan summary, phase and conditions
+func aggregateNodes(clusterScan *scanv1alpha1.ClusterScan) {
+	total := &scanv1alpha1.VulnerabilitySummary{}
+	seen := map[string]bool{}
+	var pending, running, violated int
+	var violations, failed []string
+	for _, node := range clusterScan.Status.Nodes {
+		switch node.Phase {
+		case PhasePending:
+			pending++
+		case PhaseRunning:
+			running++
+		case PhaseFailed:
+			failed = append(failed, node.Name)
+		case PhasePolicyViolated:
+			violated++
+			violations = append(violations, fmt.Sprintf("node %s exceeded the failure policy", node.Name))
+		}
+		addSummary(total, node.Summary, seen)
+	}
+	clusterScan.Status.Summary = total
+	clusterScan.Status.FailedNodes = failed
+
+	count := len(clusterScan.Status.Nodes)
+	condition := metav1.Condition{Type: ConditionReady}
+	switch {
+	case count == 0:
+		clusterScan.Status.Phase = PhaseCompleted
+		condition.Status, condition.Reason = metav1.ConditionTrue, "NoNodes"
+		condition.Message = "No Ready nodes matched the node selector"
+	case pending+running > 0:
+		clusterScan.Status.Phase = PhaseRunning
+		condition.Status, condition.Reason = metav1.ConditionFalse, "Running"
+		condition.Message = fmt.Sprintf("Scanned %d of %d nodes", count-pending-running, count)
+	case len(failed) > 0:
+		clusterScan.Status.Phase = PhaseFailed
+		condition.Status, condition.Reason = metav1.ConditionFalse, "Failed"
+		condition.Message = fmt.Sprintf("%d of %d node scans failed: %s", len(failed), count, strings.Join(failed, ", "))
+	default:
+		clusterScan.Status.Phase = PhaseCompleted
+		if violated > 0 {
+			clusterScan.Status.Phase = PhasePolicyViolated
+		}
+		condition.Status, condition.Reason = metav1.ConditionTrue, "Completed"
+		condition.Message = fmt.Sprintf("Scanned %d nodes", count)
+	}
+	meta.SetStatusCondition(&clusterScan.Status.Conditions, condition)
+
+	if pending+running == 0 {
+		setPolicyCondition(clusterScan, violations, true)
+	}
+}
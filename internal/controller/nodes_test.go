@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Node fan-out", func() {
+	node := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+			}},
+		}
+	}
+
+	newReconciler := func(objs ...client.Object) *ClusterScanReconciler {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(objs...).WithStatusSubresource(&scanv1alpha1.ClusterScan{}, &batchv1.Job{}).Build()
+		return &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20)}
+	}
+
+	It("should run one host access Job pinned to each Ready node and aggregate their outcomes", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "cis", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:      "aquasec/kube-bench:v0.7.0",
+				Command:    []string{"kube-bench", "run", "--json"},
+				HostAccess: &scanv1alpha1.HostAccess{Profile: scanv1alpha1.HostAccessKubeBench, AllNodes: true},
+			},
+		}
+		r := newReconciler(scan,
+			node("worker-b", corev1.ConditionTrue),
+			node("control-plane", corev1.ConditionTrue),
+			node("worker-down", corev1.ConditionFalse),
+		)
+		ctx := context.Background()
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scan)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(scan), scan)).To(Succeed())
+		Expect(scan.Status.Phase).To(Equal(PhaseRunning))
+		Expect(scan.Status.Nodes).To(HaveLen(2))
+		Expect(scan.Status.Nodes[0].Name).To(Equal("control-plane"))
+
+		jobs := &batchv1.JobList{}
+		Expect(r.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(2))
+		pinned := map[string]string{}
+		for _, job := range jobs.Items {
+			pod := job.Spec.Template.Spec
+			Expect(pod.HostPID).To(BeTrue())
+			Expect(job.Annotations[NodeAnnotation]).To(Equal(pod.NodeName))
+			pinned[pod.NodeName] = job.Name
+		}
+		Expect(pinned).To(HaveKeyWithValue("control-plane", nodeJobName(scan, "control-plane")))
+		Expect(pinned).To(HaveKey("worker-b"))
+
+		for _, job := range jobs.Items {
+			if job.Spec.Template.Spec.NodeName == "worker-b" {
+				job.Status.Failed = 1
+			} else {
+				job.Status.Succeeded = 1
+			}
+			Expect(r.Status().Update(ctx, &job)).To(Succeed())
+		}
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scan)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(scan), scan)).To(Succeed())
+		Expect(scan.Status.Nodes[0].Phase).To(Equal(PhaseCompleted))
+		Expect(scan.Status.Nodes[1].Phase).To(Equal(PhaseFailed))
+		Expect(scan.Status.Phase).To(Equal(PhaseFailed))
+		Expect(scan.Status.FailedNodes).To(Equal([]string{"worker-b"}))
+		Expect(meta.FindStatusCondition(scan.Status.Conditions, ConditionReady).Message).To(ContainSubstring("worker-b"))
+		Expect(scan.Status.History).To(HaveLen(2))
+	})
+
+	It("should keep the report of every node beyond the history limit", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "cis", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:      "aquasec/kube-bench:v0.7.0",
+				Command:    []string{"kube-bench", "run", "--json"},
+				HostAccess: &scanv1alpha1.HostAccess{Profile: scanv1alpha1.HostAccessKubeBench, AllNodes: true},
+			},
+		}
+		objs := []client.Object{scan}
+		for _, name := range []string{"node-a", "node-b", "node-c", "node-d", "node-e", "node-f"} {
+			objs = append(objs, node(name, corev1.ConditionTrue))
+		}
+		r := newReconciler(objs...)
+		r.KubeClient = kubefake.NewSimpleClientset()
+		r.Recorder = record.NewFakeRecorder(100)
+		ctx := context.Background()
+		key := client.ObjectKeyFromObject(scan)
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		jobs := &batchv1.JobList{}
+		Expect(r.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(6))
+		for _, job := range jobs.Items {
+			job.Status.Succeeded = 1
+			Expect(r.Status().Update(ctx, &job)).To(Succeed())
+			Expect(r.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abcde", Namespace: "default", Labels: map[string]string{"job-name": job.Name}},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+					Name: ScannerContainer, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+				}}},
+			})).To(Succeed())
+		}
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, scan)).To(Succeed())
+		Expect(len(scan.Status.History)).To(BeNumerically("<", 6))
+		for _, node := range scan.Status.Nodes {
+			Expect(node.Report).NotTo(BeEmpty())
+			Expect(r.Get(ctx, client.ObjectKey{Name: node.Report, Namespace: "default"}, &scanv1alpha1.ScanReport{})).To(Succeed())
+		}
+	})
+
+	It("should pin Jobs with node affinity to the nodes matching perNode", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "os-check", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:   "example.com/host-check:1.0",
+				Command: []string{"host-check"},
+				PerNode: &scanv1alpha1.PerNode{NodeSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"pool": "gpu"},
+				}},
+			},
+		}
+		gpu := node("gpu-1", corev1.ConditionTrue)
+		gpu.Labels = map[string]string{"pool": "gpu"}
+		r := newReconciler(scan, gpu, node("cpu-1", corev1.ConditionTrue))
+		ctx := context.Background()
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scan)})
+		Expect(err).NotTo(HaveOccurred())
+
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, client.ObjectKey{Name: nodeJobName(scan, "gpu-1"), Namespace: "default"}, job)).To(Succeed())
+		pod := job.Spec.Template.Spec
+		Expect(pod.NodeName).To(BeEmpty())
+		Expect(pod.HostPID).To(BeFalse())
+		terms := pod.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		Expect(terms).To(HaveLen(1))
+		Expect(terms[0].MatchFields).To(ConsistOf(corev1.NodeSelectorRequirement{
+			Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"gpu-1"},
+		}))
+		Expect(jobNode(job)).To(Equal("gpu-1"))
+
+		jobs := &batchv1.JobList{}
+		Expect(r.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+	})
+
+	It("should require the node in every existing node affinity term", func() {
+		pod := &corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}}},
+				{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}}},
+			}},
+		}}}
+		pinToNode(pod, "node-1")
+		for _, term := range pod.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			Expect(term.MatchExpressions).To(HaveLen(1))
+			Expect(term.MatchFields).To(HaveLen(1))
+		}
+	})
+})
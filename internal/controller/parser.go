@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
+)
+
+// Normalized severities used by every parser
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+// maxTopCVEs caps the number of finding IDs recorded in the status summary
+const maxTopCVEs = 10
+
+var severityRank = map[string]int{
+	SeverityCritical: 0,
+	SeverityHigh:     1,
+	SeverityMedium:   2,
+	SeverityLow:      3,
+	SeverityUnknown:  4,
+}
+
+// ParseResult is a scanner's output normalized into the common Finding model
+type ParseResult struct {
+	Findings []scanv1alpha1.Finding
+
+	// ArtifactDigest is the digest of the scanned image, for scanners that report it
+	ArtifactDigest string
+
+	// DBVersion identifies the vulnerability database the scanner used, for scanners that report it
+	DBVersion string
+}
+
+// ResultParser converts a scanner's native output into normalized findings
+type ResultParser interface {
+	Parse(output []byte) (*ParseResult, error)
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]ResultParser{
+		scanner.Trivy:     trivyParser{},
+		scanner.Grype:     grypeParser{},
+		scanner.KubeBench: kubeBenchParser{},
+		scanner.Kubesec:   kubesecParser{},
+	}
+)
+
+// RegisterParser adds or replaces the parser used for a scanner type
+func RegisterParser(scannerType string, parser ResultParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[scannerType] = parser
+}
+
+func parserFor(scannerType string) (ResultParser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	parser, ok := parsers[scannerType]
+	return parser, ok
+}
+
+// summarizeFindings counts findings by severity and picks the most severe IDs
+func summarizeFindings(findings []scanv1alpha1.Finding) *scanv1alpha1.VulnerabilitySummary {
+	summary := &scanv1alpha1.VulnerabilitySummary{}
+	for _, f := range findings {
+		switch f.Severity {
+		case SeverityCritical:
+			summary.Critical++
+		case SeverityHigh:
+			summary.High++
+		case SeverityMedium:
+			summary.Medium++
+		case SeverityLow:
+			summary.Low++
+		default:
+			summary.Unknown++
+		}
+		if f.FixedVersion != "" {
+			summary.Fixable++
+		}
+	}
+	summary.TopCVEs = topFindingIDs(findings)
+	return summary
+}
+
+func topFindingIDs(findings []scanv1alpha1.Finding) []string {
+	sorted := make([]scanv1alpha1.Finding, len(findings))
+	copy(sorted, findings)
+	sortFindings(sorted)
+
+	var ids []string
+	seen := map[string]bool{}
+	for _, f := range sorted {
+		if len(ids) == maxTopCVEs {
+			break
+		}
+		if f.ID == "" || seen[f.ID] {
+			continue
+		}
+		seen[f.ID] = true
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+// sortFindings orders findings by severity, most severe first, then by ID
+func sortFindings(findings []scanv1alpha1.Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		ri, rj := severityRank[findings[i].Severity], severityRank[findings[j].Severity]
+		if ri != rj {
+			return ri < rj
+		}
+		return findings[i].ID < findings[j].ID
+	})
+}
+
+// normalizeSeverity maps scanner-specific severity labels (e.g. Grype's "High") onto the normalized set
+func normalizeSeverity(severity string) string {
+	severity = strings.ToUpper(strings.TrimSpace(severity))
+	if _, ok := severityRank[severity]; ok {
+		return severity
+	}
+	return SeverityUnknown
+}
+
+// extractJSON returns the output starting at the first line that opens a JSON document.
+// Scanners log progress to stderr, which ends up in the pod logs ahead of the report.
+func extractJSON(output []byte) []byte {
+	offset := 0
+	for _, line := range bytes.SplitAfter(output, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")) {
+			return output[offset:]
+		}
+		offset += len(line)
+	}
+	return nil
+}
+
+// digestOf returns the digest part of an image reference such as nginx@sha256:abc
+func digestOf(ref string) string {
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		return ref[i+1:]
+	}
+	if strings.HasPrefix(ref, "sha256:") {
+		return ref
+	}
+	return ""
+}
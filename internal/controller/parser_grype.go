@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+type grypeParser struct{}
+
+type grypeReport struct {
+	Matches []grypeMatch `json:"matches"`
+	Source  struct {
+		Target json.RawMessage `json:"target"`
+	} `json:"source"`
+	Descriptor struct {
+		DB struct {
+			Built  string `json:"built"`
+			Status struct {
+				Built string `json:"built"`
+			} `json:"status"`
+		} `json:"db"`
+	} `json:"descriptor"`
+}
+
+type grypeMatch struct {
+	Vulnerability struct {
+		ID          string `json:"id"`
+		Severity    string `json:"severity"`
+		Description string `json:"description"`
+		Fix         struct {
+			Versions []string `json:"versions"`
+			State    string   `json:"state"`
+		} `json:"fix"`
+	} `json:"vulnerability"`
+	Artifact struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Type    string `json:"type"`
+	} `json:"artifact"`
+}
+
+// Parse decodes the report produced by "grype <target> -o json"
+func (grypeParser) Parse(output []byte) (*ParseResult, error) {
+	data := extractJSON(output)
+	if data == nil {
+		return nil, fmt.Errorf("no JSON document found in scanner output")
+	}
+
+	var report grypeReport
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&report); err != nil {
+		return nil, fmt.Errorf("invalid grype JSON: %v", err)
+	}
+
+	target, digest := grypeTarget(report.Source.Target)
+	parsed := &ParseResult{
+		Findings:       make([]scanv1alpha1.Finding, 0, len(report.Matches)),
+		ArtifactDigest: digest,
+		DBVersion:      report.Descriptor.DB.Built,
+	}
+	// Newer grype releases nest the build time under db.status
+	if parsed.DBVersion == "" {
+		parsed.DBVersion = report.Descriptor.DB.Status.Built
+	}
+	for _, m := range report.Matches {
+		finding := scanv1alpha1.Finding{
+			ID:               m.Vulnerability.ID,
+			Severity:         normalizeSeverity(m.Vulnerability.Severity),
+			Title:            m.Vulnerability.Description,
+			Target:           target,
+			Package:          m.Artifact.Name,
+			InstalledVersion: m.Artifact.Version,
+		}
+		if m.Vulnerability.Fix.State == "fixed" && len(m.Vulnerability.Fix.Versions) > 0 {
+			finding.FixedVersion = strings.Join(m.Vulnerability.Fix.Versions, ", ")
+		}
+		parsed.Findings = append(parsed.Findings, finding)
+	}
+	return parsed, nil
+}
+
+// grypeTarget reads source.target, which is an object for images and a plain string for directories
+func grypeTarget(raw json.RawMessage) (name, digest string) {
+	var image struct {
+		UserInput      string `json:"userInput"`
+		ManifestDigest string `json:"manifestDigest"`
+	}
+	if err := json.Unmarshal(raw, &image); err == nil && image.UserInput != "" {
+		return image.UserInput, image.ManifestDigest
+	}
+	var path string
+	if err := json.Unmarshal(raw, &path); err == nil {
+		return path, ""
+	}
+	return "", ""
+}
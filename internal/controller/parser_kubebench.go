@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// kube-bench reports check outcomes rather than severities. Failed scored checks are
+// reported as HIGH, failed unscored checks as MEDIUM and warnings as LOW.
+type kubeBenchParser struct{}
+
+type kubeBenchReport struct {
+	Controls []kubeBenchControls `json:"Controls"`
+}
+
+type kubeBenchControls struct {
+	ID       string           `json:"id"`
+	Text     string           `json:"text"`
+	NodeType string           `json:"node_type"`
+	Groups   []kubeBenchGroup `json:"tests"`
+}
+
+type kubeBenchGroup struct {
+	Section string            `json:"section"`
+	Checks  []kubeBenchResult `json:"results"`
+}
+
+type kubeBenchResult struct {
+	TestNumber string `json:"test_number"`
+	TestDesc   string `json:"test_desc"`
+	Status     string `json:"status"`
+	Scored     bool   `json:"scored"`
+}
+
+// Parse decodes the output of "kube-bench --json". Depending on the version, kube-bench emits
+// either a single {"Controls": [...]} object or one array of controls per target.
+func (kubeBenchParser) Parse(output []byte) (*ParseResult, error) {
+	data := extractJSON(output)
+	if data == nil {
+		return nil, fmt.Errorf("no JSON document found in scanner output")
+	}
+
+	var controls []kubeBenchControls
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			if len(controls) > 0 {
+				break
+			}
+			return nil, fmt.Errorf("invalid kube-bench JSON: %v", err)
+		}
+
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 && raw[0] == '[' {
+			var list []kubeBenchControls
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, fmt.Errorf("invalid kube-bench JSON: %v", err)
+			}
+			controls = append(controls, list...)
+			continue
+		}
+
+		var report kubeBenchReport
+		if err := json.Unmarshal(raw, &report); err != nil {
+			return nil, fmt.Errorf("invalid kube-bench JSON: %v", err)
+		}
+		controls = append(controls, report.Controls...)
+	}
+
+	parsed := &ParseResult{}
+	for _, control := range controls {
+		for _, group := range control.Groups {
+			for _, check := range group.Checks {
+				severity := kubeBenchSeverity(check)
+				if severity == "" {
+					continue
+				}
+				parsed.Findings = append(parsed.Findings, scanv1alpha1.Finding{
+					ID:       check.TestNumber,
+					Severity: severity,
+					Title:    check.TestDesc,
+					Target:   control.NodeType,
+				})
+			}
+		}
+	}
+	return parsed, nil
+}
+
+func kubeBenchSeverity(check kubeBenchResult) string {
+	switch check.Status {
+	case "FAIL":
+		if check.Scored {
+			return SeverityHigh
+		}
+		return SeverityMedium
+	case "WARN":
+		return SeverityLow
+	default:
+		return ""
+	}
+}
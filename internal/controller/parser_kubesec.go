@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// kubesec splits its rules into "critical" ones, which fail the scan, and "advise" ones,
+// which are hardening suggestions. They are reported as CRITICAL and LOW respectively.
+type kubesecParser struct{}
+
+type kubesecResult struct {
+	Object  string `json:"object"`
+	Message string `json:"message"`
+	Scoring struct {
+		Critical []kubesecRule `json:"critical"`
+		Advise   []kubesecRule `json:"advise"`
+	} `json:"scoring"`
+}
+
+type kubesecRule struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Parse decodes the JSON array produced by "kubesec scan"
+func (kubesecParser) Parse(output []byte) (*ParseResult, error) {
+	data := extractJSON(output)
+	if data == nil {
+		return nil, fmt.Errorf("no JSON document found in scanner output")
+	}
+
+	var results []kubesecResult
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&results); err != nil {
+		return nil, fmt.Errorf("invalid kubesec JSON: %v", err)
+	}
+
+	parsed := &ParseResult{}
+	for _, result := range results {
+		for _, rule := range result.Scoring.Critical {
+			parsed.Findings = append(parsed.Findings, scanv1alpha1.Finding{
+				ID: rule.ID, Severity: SeverityCritical, Title: rule.Reason, Target: result.Object,
+			})
+		}
+		for _, rule := range result.Scoring.Advise {
+			parsed.Findings = append(parsed.Findings, scanv1alpha1.Finding{
+				ID: rule.ID, Severity: SeverityLow, Title: rule.Reason, Target: result.Object,
+			})
+		}
+	}
+	return parsed, nil
+}
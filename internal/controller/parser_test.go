@@ -0,0 +1,178 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
+)
+
+const trivyOutput = `2024-11-29T08:30:45.123Z	INFO	Vulnerability scanning is enabled
+2024-11-29T08:30:47.456Z	INFO	Detected OS: debian
+{
+  "SchemaVersion": 2,
+  "ArtifactName": "nginx:1.19",
+  "Metadata": {"RepoDigests": ["nginx@sha256:df13abe416e37eb3db4722840dd479b00ba193ac6606e7902331dcea50f4f1f2"]},
+  "Results": [
+    {
+      "Target": "nginx:1.19 (debian 10.10)",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2021-0002", "PkgName": "libssl", "FixedVersion": "1.1.1n", "Severity": "HIGH"},
+        {"VulnerabilityID": "CVE-2021-0001", "PkgName": "libc", "FixedVersion": "", "Severity": "CRITICAL"},
+        {"VulnerabilityID": "CVE-2021-0003", "PkgName": "zlib", "FixedVersion": "1.2.12", "Severity": "MEDIUM"}
+      ]
+    },
+    {
+      "Target": "usr/local/bin/app",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2021-0001", "PkgName": "libc", "FixedVersion": "", "Severity": "CRITICAL"},
+        {"VulnerabilityID": "CVE-2021-0004", "PkgName": "curl", "FixedVersion": "", "Severity": "LOW"},
+        {"VulnerabilityID": "GHSA-xxxx", "PkgName": "lodash", "FixedVersion": "4.17.21", "Severity": "UNKNOWN"}
+      ]
+    }
+  ]
+}
+`
+
+const grypeOutput = `{
+  "matches": [
+    {
+      "vulnerability": {"id": "CVE-2022-0001", "severity": "High", "fix": {"versions": ["3.0.7"], "state": "fixed"}},
+      "artifact": {"name": "openssl", "version": "3.0.2", "type": "deb"}
+    },
+    {
+      "vulnerability": {"id": "CVE-2022-0002", "severity": "Negligible", "fix": {"versions": [], "state": "not-fixed"}},
+      "artifact": {"name": "bash", "version": "5.1", "type": "deb"}
+    }
+  ],
+  "source": {"type": "image", "target": {"userInput": "nginx:1.19", "manifestDigest": "sha256:abc123"}},
+  "descriptor": {"name": "grype", "db": {"built": "2024-11-29T01:23:45Z"}}
+}`
+
+const kubeBenchOutput = `{"Controls": [{
+  "id": "4", "text": "Worker Node Security Configuration", "node_type": "node",
+  "tests": [{"section": "4.1", "results": [
+    {"test_number": "4.1.1", "test_desc": "Ensure kubelet service file permissions", "status": "PASS", "scored": true},
+    {"test_number": "4.1.2", "test_desc": "Ensure kubelet service file ownership", "status": "FAIL", "scored": true},
+    {"test_number": "4.1.3", "test_desc": "Ensure proxy kubeconfig permissions", "status": "FAIL", "scored": false},
+    {"test_number": "4.1.4", "test_desc": "Ensure proxy kubeconfig ownership", "status": "WARN", "scored": false}
+  ]}]
+}], "Totals": {"total_pass": 1, "total_fail": 2, "total_warn": 1}}`
+
+const kubesecOutput = `[{
+  "object": "Pod/privileged.default",
+  "valid": true,
+  "message": "Failed with a score of -30 points",
+  "scoring": {
+    "critical": [{"id": "Privileged", "reason": "Privileged containers can allow almost completely unrestricted host access"}],
+    "advise": [{"id": "ReadOnlyRootFilesystem", "reason": "An immutable root filesystem can prevent malicious binaries"}]
+  }
+}]`
+
+var _ = Describe("Result parsers", func() {
+	Context("Trivy", func() {
+		It("should summarize vulnerabilities by severity", func() {
+			parsed, err := trivyParser{}.Parse([]byte(trivyOutput))
+			Expect(err).NotTo(HaveOccurred())
+			summary := summarizeFindings(parsed.Findings)
+
+			Expect(summary.Critical).To(Equal(int32(2)))
+			Expect(summary.High).To(Equal(int32(1)))
+			Expect(summary.Medium).To(Equal(int32(1)))
+			Expect(summary.Low).To(Equal(int32(1)))
+			Expect(summary.Unknown).To(Equal(int32(1)))
+			Expect(summary.Fixable).To(Equal(int32(3)))
+		})
+
+		It("should report the image digest", func() {
+			parsed, err := trivyParser{}.Parse([]byte(trivyOutput))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.ArtifactDigest).To(Equal("sha256:df13abe416e37eb3db4722840dd479b00ba193ac6606e7902331dcea50f4f1f2"))
+		})
+
+		It("should list top CVEs by severity without duplicates", func() {
+			parsed, err := trivyParser{}.Parse([]byte(trivyOutput))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summarizeFindings(parsed.Findings).TopCVEs).To(Equal([]string{
+				"CVE-2021-0001", "CVE-2021-0002", "CVE-2021-0003", "CVE-2021-0004", "GHSA-xxxx",
+			}))
+		})
+
+		It("should handle reports without vulnerabilities", func() {
+			parsed, err := trivyParser{}.Parse([]byte(`{"SchemaVersion": 2, "Results": [{"Target": "alpine"}]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Findings).To(BeEmpty())
+		})
+
+		It("should fail on table output", func() {
+			_, err := trivyParser{}.Parse([]byte("nginx:1.19 (debian 10.10)\nTotal: 3 (HIGH: 2, CRITICAL: 1)\n"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Grype", func() {
+		It("should normalize severities and fix versions", func() {
+			parsed, err := grypeParser{}.Parse([]byte(grypeOutput))
+			Expect(err).NotTo(HaveOccurred())
+			findings := parsed.Findings
+			Expect(findings).To(HaveLen(2))
+			Expect(parsed.ArtifactDigest).To(Equal("sha256:abc123"))
+			Expect(parsed.DBVersion).To(Equal("2024-11-29T01:23:45Z"))
+			Expect(findings[0]).To(Equal(scanv1alpha1.Finding{
+				ID: "CVE-2022-0001", Severity: SeverityHigh, Target: "nginx:1.19",
+				Package: "openssl", InstalledVersion: "3.0.2", FixedVersion: "3.0.7",
+			}))
+			Expect(findings[1].Severity).To(Equal(SeverityUnknown))
+			Expect(findings[1].FixedVersion).To(BeEmpty())
+		})
+	})
+
+	Context("kube-bench", func() {
+		It("should report failed and warned checks only", func() {
+			parsed, err := kubeBenchParser{}.Parse([]byte(kubeBenchOutput))
+			Expect(err).NotTo(HaveOccurred())
+			findings := parsed.Findings
+			Expect(findings).To(HaveLen(3))
+			Expect(findings[0].ID).To(Equal("4.1.2"))
+			Expect(findings[0].Severity).To(Equal(SeverityHigh))
+			Expect(findings[0].Target).To(Equal("node"))
+			Expect(findings[1].Severity).To(Equal(SeverityMedium))
+			Expect(findings[2].Severity).To(Equal(SeverityLow))
+		})
+
+		It("should accept the legacy array format with one document per target", func() {
+			legacy := `[{"id": "1", "node_type": "master", "tests": [{"results": [{"test_number": "1.1.1", "status": "FAIL", "scored": true}]}]}]
+[{"id": "4", "node_type": "node", "tests": [{"results": [{"test_number": "4.1.1", "status": "FAIL", "scored": true}]}]}]`
+			parsed, err := kubeBenchParser{}.Parse([]byte(legacy))
+			Expect(err).NotTo(HaveOccurred())
+			findings := parsed.Findings
+			Expect(findings).To(HaveLen(2))
+			Expect(findings[1].Target).To(Equal("node"))
+		})
+	})
+
+	Context("kubesec", func() {
+		It("should map critical and advisory rules", func() {
+			parsed, err := kubesecParser{}.Parse([]byte(kubesecOutput))
+			Expect(err).NotTo(HaveOccurred())
+			findings := parsed.Findings
+			Expect(findings).To(HaveLen(2))
+			Expect(findings[0].ID).To(Equal("Privileged"))
+			Expect(findings[0].Severity).To(Equal(SeverityCritical))
+			Expect(findings[0].Target).To(Equal("Pod/privileged.default"))
+			Expect(findings[1].Severity).To(Equal(SeverityLow))
+		})
+	})
+
+	Context("Registry", func() {
+		It("should provide a parser for every known scanner", func() {
+			for _, scannerType := range scanner.Known {
+				_, ok := parserFor(scannerType)
+				Expect(ok).To(BeTrue(), "missing parser for %s", scannerType)
+			}
+			_, ok := parserFor(scanner.Unknown)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+type trivyParser struct{}
+
+type trivyReport struct {
+	ArtifactName string        `json:"ArtifactName"`
+	Metadata     trivyMetadata `json:"Metadata"`
+	Results      []trivyResult `json:"Results"`
+}
+
+type trivyMetadata struct {
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+type trivyResult struct {
+	Target          string               `json:"Target"`
+	Vulnerabilities []trivyVulnerability `json:"Vulnerabilities"`
+}
+
+type trivyVulnerability struct {
+	VulnerabilityID  string `json:"VulnerabilityID"`
+	PkgName          string `json:"PkgName"`
+	InstalledVersion string `json:"InstalledVersion"`
+	FixedVersion     string `json:"FixedVersion"`
+	Severity         string `json:"Severity"`
+	Title            string `json:"Title"`
+}
+
+// Parse decodes the report produced by "trivy image --format json"
+func (trivyParser) Parse(output []byte) (*ParseResult, error) {
+	data := extractJSON(output)
+	if data == nil {
+		return nil, fmt.Errorf("no JSON document found in scanner output")
+	}
+
+	var report trivyReport
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&report); err != nil {
+		return nil, fmt.Errorf("invalid trivy JSON: %v", err)
+	}
+
+	parsed := &ParseResult{}
+	if len(report.Metadata.RepoDigests) > 0 {
+		parsed.ArtifactDigest = digestOf(report.Metadata.RepoDigests[0])
+	}
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			parsed.Findings = append(parsed.Findings, scanv1alpha1.Finding{
+				ID:               v.VulnerabilityID,
+				Severity:         normalizeSeverity(v.Severity),
+				Title:            v.Title,
+				Target:           result.Target,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+			})
+		}
+	}
+	return parsed, nil
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// scanPodTemplate builds the scan Pod shared by one-off, scheduled and selector scan Jobs
+func scanPodTemplate(clusterScan *scanv1alpha1.ClusterScan) corev1.PodTemplateSpec {
+	// Copy the spec so Jobs built from the template never share slices or maps with the ClusterScan
+	spec := clusterScan.Spec.DeepCopy()
+	container := corev1.Container{
+		Name:         ScannerContainer,
+		Image:        spec.Image,
+		Command:      scanCommand(clusterScan),
+		Env:          spec.Env,
+		EnvFrom:      spec.EnvFrom,
+		VolumeMounts: spec.VolumeMounts,
+	}
+	if spec.Resources != nil {
+		container.Resources = *spec.Resources
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{ScanNameLabel: clusterScan.Name},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:      corev1.RestartPolicyOnFailure,
+			Containers:         []corev1.Container{container},
+			Volumes:            spec.Volumes,
+			ServiceAccountName: spec.ServiceAccountName,
+			NodeSelector:       spec.NodeSelector,
+			Tolerations:        spec.Tolerations,
+			Affinity:           spec.Affinity,
+			ImagePullSecrets:   spec.ImagePullSecrets,
+		},
+	}
+	applyTargetCredentials(clusterScan, &template.Spec)
+	applyHostAccess(clusterScan, &template.Spec)
+	applySidecars(clusterScan, &template.Spec)
+	return template
+}
+
+// scannerContainer returns the scanner container of a scan Pod, which is never a sidecar
+func scannerContainer(pod *corev1.PodSpec) *corev1.Container {
+	for i := range pod.Containers {
+		if pod.Containers[i].Name == ScannerContainer {
+			return &pod.Containers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Scan pod template", func() {
+	scan := func() *scanv1alpha1.ClusterScan {
+		return &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:  "aquasec/trivy:0.50.0",
+				Target: "nginx:1.25",
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+				Env: []corev1.EnvVar{{Name: "TRIVY_SEVERITY", Value: "HIGH,CRITICAL"}},
+				EnvFrom: []corev1.EnvFromSource{{
+					SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "registry"}},
+				}},
+				Volumes: []corev1.Volume{{
+					Name:         "cache",
+					VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				}},
+				VolumeMounts:       []corev1.VolumeMount{{Name: "cache", MountPath: "/root/.cache"}},
+				ServiceAccountName: "scanner",
+				NodeSelector:       map[string]string{"kubernetes.io/os": "linux"},
+				Tolerations:        []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			},
+		}
+	}
+
+	It("should pass the pod settings through to the scanner container and pod", func() {
+		template := scanPodTemplate(scan())
+		container := template.Spec.Containers[0]
+		Expect(container.Command).To(Equal([]string{"trivy", "image", "--format", "json", "nginx:1.25"}))
+		Expect(container.Resources.Limits.Memory().String()).To(Equal("1Gi"))
+		Expect(container.Env).To(ConsistOf(corev1.EnvVar{Name: "TRIVY_SEVERITY", Value: "HIGH,CRITICAL"}))
+		Expect(container.EnvFrom).To(HaveLen(1))
+		Expect(container.VolumeMounts).To(HaveLen(1))
+		Expect(template.Spec.Volumes).To(HaveLen(1))
+		Expect(template.Spec.ServiceAccountName).To(Equal("scanner"))
+		Expect(template.Spec.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+		Expect(template.Spec.Tolerations).To(HaveLen(1))
+	})
+
+	It("should build the same pod for one-off Jobs and selector Jobs", func() {
+		r := &ClusterScanReconciler{Scheme: scheme.Scheme}
+		clusterScan := scan()
+		job := r.constructJob(clusterScan, "nginx-job")
+		targetJob := r.constructTargetJob(clusterScan, "nginx-1234", "redis:7")
+
+		Expect(job.Spec.Template.Spec.ServiceAccountName).To(Equal("scanner"))
+		Expect(targetJob.Spec.Template.Spec.ServiceAccountName).To(Equal("scanner"))
+		Expect(targetJob.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: TargetEnvVar, Value: "redis:7"}))
+
+		// Adding the target variable must not leak into the ClusterScan or other Jobs
+		Expect(clusterScan.Spec.Env).To(HaveLen(1))
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(HaveLen(1))
+	})
+
+	It("should mount DockerConfigJSON credentials and point DOCKER_CONFIG at them", func() {
+		clusterScan := scan()
+		clusterScan.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "scanner-pull"}}
+		clusterScan.Spec.TargetCredentials = &scanv1alpha1.TargetCredentials{
+			SecretName: "registry", Type: scanv1alpha1.CredentialsDockerConfigJSON,
+		}
+
+		template := scanPodTemplate(clusterScan)
+		Expect(template.Spec.ImagePullSecrets).To(ConsistOf(corev1.LocalObjectReference{Name: "scanner-pull"}))
+		Expect(template.Spec.Volumes).To(ContainElement(HaveField("Name", TargetCredentialsVolume)))
+		container := template.Spec.Containers[0]
+		Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+			Name: TargetCredentialsVolume, MountPath: targetCredentialsPath, ReadOnly: true,
+		}))
+		Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "DOCKER_CONFIG", Value: targetCredentialsPath}))
+		Expect(clusterScan.Spec.Volumes).To(HaveLen(1))
+	})
+
+	It("should map basic-auth credentials to the scanner's variables", func() {
+		clusterScan := scan()
+		clusterScan.Spec.TargetCredentials = &scanv1alpha1.TargetCredentials{
+			SecretName: "registry", Type: scanv1alpha1.CredentialsBasicAuth,
+		}
+		env := scanPodTemplate(clusterScan).Spec.Containers[0].Env
+		Expect(env).To(ContainElement(secretEnv("TRIVY_USERNAME", "registry", "username")))
+		Expect(env).To(ContainElement(secretEnv("TRIVY_PASSWORD", "registry", "password")))
+
+		clusterScan.Spec.Image = "anchore/grype:v0.74.0"
+		clusterScan.Spec.Target = "registry.example.com:5000/team/app:1.0"
+		env = scanPodTemplate(clusterScan).Spec.Containers[0].Env
+		Expect(env).To(ContainElement(secretEnv("GRYPE_REGISTRY_AUTH_USERNAME", "registry", "username")))
+		Expect(env).To(ContainElement(corev1.EnvVar{Name: "GRYPE_REGISTRY_AUTH_AUTHORITY", Value: "registry.example.com:5000"}))
+	})
+
+	It("should grant the kube-bench host access profile", func() {
+		clusterScan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "cis", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:   "aquasec/kube-bench:v0.7.0",
+				Command: []string{"kube-bench", "run", "--targets", "master,node", "--json"},
+				HostAccess: &scanv1alpha1.HostAccess{
+					Profile: scanv1alpha1.HostAccessKubeBench, NodeName: "control-plane",
+				},
+			},
+		}
+		pod := scanPodTemplate(clusterScan).Spec
+		Expect(pod.HostPID).To(BeTrue())
+		Expect(pod.NodeName).To(Equal("control-plane"))
+		Expect(pod.Tolerations).To(ContainElement(corev1.Toleration{Operator: corev1.TolerationOpExists}))
+		for _, path := range []string{"/etc/kubernetes", "/var/lib/kubelet", "/etc/systemd"} {
+			Expect(pod.Volumes).To(ContainElement(HaveField("VolumeSource.HostPath.Path", path)))
+			Expect(pod.Containers[0].VolumeMounts).To(ContainElement(And(
+				HaveField("MountPath", path), HaveField("ReadOnly", true))))
+		}
+
+		// Only the scanner container gets the host mounts
+		clusterScan.Spec.Sidecars = []corev1.Container{{Name: "uploader", Image: "busybox:1.36"}}
+		pod = scanPodTemplate(clusterScan).Spec
+		Expect(pod.Containers).To(HaveLen(2))
+		Expect(scannerContainer(&pod).VolumeMounts).To(ContainElement(HaveField("MountPath", "/etc/kubernetes")))
+		Expect(pod.Containers[1].VolumeMounts).NotTo(ContainElement(HaveField("MountPath", "/etc/kubernetes")))
+	})
+
+	It("should never grant host access to scanners other than kube-bench", func() {
+		clusterScan := scan()
+		clusterScan.Spec.HostAccess = &scanv1alpha1.HostAccess{Profile: scanv1alpha1.HostAccessKubeBench}
+		pod := scanPodTemplate(clusterScan).Spec
+		Expect(pod.HostPID).To(BeFalse())
+		Expect(pod.Tolerations).NotTo(ContainElement(corev1.Toleration{Operator: corev1.TolerationOpExists}))
+		Expect(pod.Volumes).NotTo(ContainElement(HaveField("VolumeSource.HostPath", Not(BeNil()))))
+	})
+
+	It("should resolve the registry of image references", func() {
+		Expect(registryHost("nginx:1.25")).To(Equal("index.docker.io"))
+		Expect(registryHost("bitnami/redis:7")).To(Equal("index.docker.io"))
+		Expect(registryHost("ghcr.io/org/app@sha256:abc")).To(Equal("ghcr.io"))
+		Expect(registryHost("localhost/app")).To(Equal("localhost"))
+	})
+})
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// evaluateFailurePolicy returns a description of every threshold the findings exceed
+func evaluateFailurePolicy(policy *scanv1alpha1.FailurePolicy, findings []scanv1alpha1.Finding) []string {
+	if policy == nil {
+		return nil
+	}
+
+	counts := map[string]int32{}
+	for _, f := range findings {
+		if policy.IgnoreUnfixed && f.FixedVersion == "" {
+			continue
+		}
+		counts[f.Severity]++
+	}
+
+	var violations []string
+	for _, threshold := range []struct {
+		severity string
+		max      *int32
+	}{
+		{SeverityCritical, policy.MaxCritical},
+		{SeverityHigh, policy.MaxHigh},
+		{SeverityMedium, policy.MaxMedium},
+		{SeverityLow, policy.MaxLow},
+	} {
+		if threshold.max != nil && counts[threshold.severity] > *threshold.max {
+			violations = append(violations, fmt.Sprintf("%d %s findings exceed the limit of %d",
+				counts[threshold.severity], threshold.severity, *threshold.max))
+		}
+	}
+	return violations
+}
+
+// setPolicyCondition records the failure policy outcome of the latest report. evaluated is
+// false when the output could not be parsed, so the policy could not be checked.
+func setPolicyCondition(clusterScan *scanv1alpha1.ClusterScan, violations []string, evaluated bool) {
+	if clusterScan.Spec.FailurePolicy == nil {
+		meta.RemoveStatusCondition(&clusterScan.Status.Conditions, ConditionPolicyViolated)
+		return
+	}
+
+	condition := metav1.Condition{
+		Type: ConditionPolicyViolated, Status: metav1.ConditionFalse, Reason: "WithinPolicy",
+		Message: "Findings are within the failure policy",
+	}
+	switch {
+	case !evaluated:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "ResultsUnavailable"
+		condition.Message = "Scan output could not be parsed to evaluate the failure policy"
+	case len(violations) > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ThresholdExceeded"
+		condition.Message = strings.Join(violations, "; ")
+	}
+	meta.SetStatusCondition(&clusterScan.Status.Conditions, condition)
+}
+
+// policyViolated reports whether the latest evaluated report broke the failure policy
+func policyViolated(clusterScan *scanv1alpha1.ClusterScan) bool {
+	return meta.IsStatusConditionTrue(clusterScan.Status.Conditions, ConditionPolicyViolated)
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Failure policy", func() {
+	findings := []scanv1alpha1.Finding{
+		{ID: "CVE-1", Severity: SeverityCritical},
+		{ID: "CVE-2", Severity: SeverityHigh, FixedVersion: "1.2"},
+		{ID: "CVE-3", Severity: SeverityHigh},
+		{ID: "CVE-4", Severity: SeverityHigh, FixedVersion: "2.0"},
+	}
+	zero, two := int32(0), int32(2)
+
+	It("should fail on any finding when the threshold is zero", func() {
+		violations := evaluateFailurePolicy(&scanv1alpha1.FailurePolicy{MaxCritical: &zero}, findings)
+		Expect(violations).To(ConsistOf("1 CRITICAL findings exceed the limit of 0"))
+	})
+
+	It("should allow findings up to the threshold", func() {
+		violations := evaluateFailurePolicy(&scanv1alpha1.FailurePolicy{MaxHigh: &two}, findings)
+		Expect(violations).To(ConsistOf("3 HIGH findings exceed the limit of 2"))
+	})
+
+	It("should ignore unfixed findings when asked", func() {
+		policy := &scanv1alpha1.FailurePolicy{MaxCritical: &zero, MaxHigh: &two, IgnoreUnfixed: true}
+		Expect(evaluateFailurePolicy(policy, findings)).To(BeEmpty())
+	})
+
+	It("should not check severities without a threshold", func() {
+		Expect(evaluateFailurePolicy(&scanv1alpha1.FailurePolicy{}, findings)).To(BeEmpty())
+		Expect(evaluateFailurePolicy(nil, findings)).To(BeEmpty())
+	})
+
+	It("should set the PolicyViolated condition only when a policy is configured", func() {
+		scan := &scanv1alpha1.ClusterScan{}
+		setPolicyCondition(scan, []string{"1 CRITICAL findings exceed the limit of 0"}, true)
+		Expect(meta.FindStatusCondition(scan.Status.Conditions, ConditionPolicyViolated)).To(BeNil())
+
+		scan.Spec.FailurePolicy = &scanv1alpha1.FailurePolicy{MaxCritical: &zero}
+		setPolicyCondition(scan, []string{"1 CRITICAL findings exceed the limit of 0"}, true)
+		Expect(policyViolated(scan)).To(BeTrue())
+
+		setPolicyCondition(scan, nil, false)
+		Expect(meta.IsStatusConditionPresentAndEqual(scan.Status.Conditions, ConditionPolicyViolated, metav1.ConditionUnknown)).To(BeTrue())
+
+		setPolicyCondition(scan, nil, true)
+		Expect(meta.IsStatusConditionFalse(scan.Status.Conditions, ConditionPolicyViolated)).To(BeTrue())
+	})
+
+	It("should leave the exit code unset until the scanner terminates", func() {
+		pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "scanner", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}}}
+		Expect(scannerExitCode(pod)).To(BeNil())
+		Expect(scannerExitCode(&corev1.Pod{})).To(BeNil())
+
+		pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}
+		Expect(scannerExitCode(pod)).To(HaveValue(Equal(int32(1))))
+	})
+})
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+)
+
+// reevaluateReports applies the exceptions now in effect and the failure policy of their
+// ClusterScan to the ScanReports in namespace, or in every namespace when it is empty, so the
+// image gate sees exceptions created, changed, expired or deleted since a scan ran. Findings are
+// parsed again from the stored raw output; reports whose output is gone only drop findings.
+func reevaluateReports(ctx context.Context, c client.Client, store resultstore.Store, namespace string) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	reports := &scanv1alpha1.ScanReportList{}
+	if err := c.List(ctx, reports, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("unable to list scan reports: %v", err)
+	}
+
+	scans := map[types.NamespacedName]*scanv1alpha1.ClusterScan{}
+	exceptions := map[string][]scanException{}
+	for i := range reports.Items {
+		report := &reports.Items[i]
+		if _, ok := parserFor(report.Spec.Scanner.Type); !ok {
+			continue
+		}
+
+		key := types.NamespacedName{Name: report.Spec.ScanName, Namespace: report.Namespace}
+		clusterScan, ok := scans[key]
+		if !ok {
+			clusterScan = &scanv1alpha1.ClusterScan{}
+			if err := c.Get(ctx, key, clusterScan); errors.IsNotFound(err) {
+				clusterScan = nil
+			} else if err != nil {
+				return fmt.Errorf("unable to get ClusterScan %s: %v", key, err)
+			}
+			scans[key] = clusterScan
+		}
+		if clusterScan == nil {
+			continue
+		}
+		active, ok := exceptions[report.Namespace]
+		if !ok {
+			var err error
+			if active, err = activeExceptions(ctx, c, report.Namespace); err != nil {
+				return err
+			}
+			exceptions[report.Namespace] = active
+		}
+
+		findings, ok := reportFindings(ctx, store, report)
+		if !ok {
+			continue
+		}
+		updated := report.DeepCopy()
+		evaluateFindings(clusterScan, updated, findings, active)
+		if equality.Semantic.DeepEqual(updated.Spec, report.Spec) {
+			continue
+		}
+		if err := c.Update(ctx, updated); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to update ScanReport %s/%s: %v", report.Namespace, report.Name, err)
+		}
+		log.Info("Re-evaluated scan report against current exceptions", "report", report.Namespace+"/"+report.Name,
+			"appliedExceptions", updated.Spec.AppliedExceptions, "policyViolations", updated.Spec.PolicyViolations)
+	}
+	return nil
+}
+
+// reportFindings returns the findings of a report before exceptions, parsed from its raw output.
+// Without the output, the findings the report lists are used unless they were truncated.
+func reportFindings(ctx context.Context, store resultstore.Store, report *scanv1alpha1.ScanReport) (
+	[]scanv1alpha1.Finding, bool) {
+	parser, _ := parserFor(report.Spec.Scanner.Type)
+	if report.Spec.RawOutput != nil {
+		if output, err := store.Get(ctx, report.Spec.RawOutput.URI); err == nil {
+			if parsed, err := parser.Parse(output); err == nil {
+				return parsed.Findings, true
+			}
+		}
+	}
+	if report.Spec.FindingsTruncated {
+		return nil, false
+	}
+	return report.Spec.Findings, true
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// SpecHashAnnotation is set on one-off scan Jobs and on CronJobs to the hash of the Job spec they
+// were created with, so objects left behind by an older ClusterScan spec can be told apart
+const SpecHashAnnotation = "scan.ahmali3.github.io/spec-hash"
+
+// podSpecHash hashes the pod spec of a scan Job. The API server defaults fields of created
+// objects, so the hash is taken before creation and compared with their annotation later.
+func podSpecHash(spec *corev1.PodSpec) string {
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// jobSpecHash hashes the pod spec of a scan Job along with the Job fields set from the ClusterScan
+// spec, so a changed timeout or retry limit also scans again. The TTL is left out: it is set on
+// finished Jobs when their run is collected, and only decides how long they are kept.
+func jobSpecHash(spec *batchv1.JobSpec) string {
+	data, _ := json.Marshal(struct {
+		Pod                   *corev1.PodSpec
+		ActiveDeadlineSeconds *int64
+		BackoffLimit          *int32
+		PodFailurePolicy      *batchv1.PodFailurePolicy
+	}{&spec.Template.Spec, spec.ActiveDeadlineSeconds, spec.BackoffLimit, spec.PodFailurePolicy})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// currentJobName returns the Job of a one-off scan's latest run, or the name of a new Job when
+// none was created yet or a run-now request asks for another run
+func currentJobName(clusterScan *scanv1alpha1.ClusterScan) string {
+	last := clusterScan.Status.LastJobName
+	// The last Job belongs to the CronJob when the scan's schedule was removed
+	if last == "" || !strings.HasPrefix(last, clusterScan.Name+"-job") || runNowToken(clusterScan) != "" {
+		return oneOffJobName(clusterScan)
+	}
+	return last
+}
+
+// specChanged reports whether a one-off scan's Job was created from an older spec. Jobs created
+// before spec hashes were recorded are kept. When the Job no longer exists, e.g. after its TTL,
+// the hash the scan last ran with is compared; scans run before it was recorded count any spec
+// change since the last reconcile.
+func specChanged(clusterScan *scanv1alpha1.ClusterScan, job *batchv1.Job, found bool, desiredHash string) bool {
+	if found {
+		hash := job.Annotations[SpecHashAnnotation]
+		return hash != "" && hash != desiredHash
+	}
+	if clusterScan.Status.SpecHash != "" {
+		return clusterScan.Status.SpecHash != desiredHash
+	}
+	observed := clusterScan.Status.ObservedGeneration
+	return observed != 0 && observed != clusterScan.Generation
+}
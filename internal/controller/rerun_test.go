@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	webhookv1alpha1 "github.com/ahmali3/clusterscan-operator/internal/webhook/v1alpha1"
+)
+
+var _ = Describe("Spec changes", func() {
+	var r *ClusterScanReconciler
+
+	newReconciler := func(objs ...client.Object) {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(objs...).WithStatusSubresource(&scanv1alpha1.ClusterScan{}).Build()
+		r = &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20)}
+	}
+
+	reconcile := func(key client.ObjectKey) *scanv1alpha1.ClusterScan {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		latest := &scanv1alpha1.ClusterScan{}
+		Expect(r.Get(context.Background(), key, latest)).To(Succeed())
+		return latest
+	}
+
+	// edit changes the spec of a ClusterScan and bumps its generation like the API server does
+	edit := func(scan *scanv1alpha1.ClusterScan, change func(*scanv1alpha1.ClusterScanSpec)) {
+		change(&scan.Spec)
+		scan.Generation++
+		Expect(r.Update(context.Background(), scan)).To(Succeed())
+	}
+
+	// finish marks a one-off scan Job as succeeded and recorded
+	finish := func(name string) {
+		job := &batchv1.Job{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Name: name, Namespace: "default"}, job)).To(Succeed())
+		job.Labels[CollectedLabel] = "true"
+		Expect(r.Update(context.Background(), job)).To(Succeed())
+		job.Status.Succeeded = 1
+		Expect(r.Status().Update(context.Background(), job)).To(Succeed())
+	}
+
+	jobNames := func() []string {
+		jobs := &batchv1.JobList{}
+		Expect(r.List(context.Background(), jobs)).To(Succeed())
+		var names []string
+		for _, job := range jobs.Items {
+			names = append(names, job.Name)
+		}
+		return names
+	}
+
+	It("should replace the Job of a one-off scan whose target changed", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:latest", Target: "nginx:1.25"},
+		}
+		newReconciler(scan)
+		key := client.ObjectKeyFromObject(scan)
+
+		latest := reconcile(key)
+		Expect(jobNames()).To(ConsistOf("nginx-job"))
+		Expect(latest.Status.ObservedGeneration).To(Equal(int64(1)))
+		finish("nginx-job")
+		latest = reconcile(key)
+		Expect(latest.Status.Phase).To(Equal(PhaseCompleted))
+
+		edit(latest, func(spec *scanv1alpha1.ClusterScanSpec) { spec.Target = "nginx:1.27" })
+		latest = reconcile(key)
+		Expect(jobNames()).To(ConsistOf("nginx-job-g2"))
+		Expect(latest.Status.Phase).To(Equal(PhaseRunning))
+		Expect(latest.Status.LastJobName).To(Equal("nginx-job-g2"))
+		Expect(latest.Status.ObservedGeneration).To(Equal(int64(2)))
+
+		job := &batchv1.Job{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Name: "nginx-job-g2", Namespace: "default"}, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Command).To(ContainElement("nginx:1.27"))
+		Expect(job.Annotations).To(HaveKey(SpecHashAnnotation))
+
+		// Later reconciles follow the new Job
+		reconcile(key)
+		Expect(jobNames()).To(ConsistOf("nginx-job-g2"))
+	})
+
+	It("should scan the new target of a ClusterScan defaulted by the webhook", func() {
+		defaulter := &webhookv1alpha1.ClusterScanWebhook{}
+		// admit runs the defaulting webhook on an update from old, like the API server does
+		admit := func(old, scan *scanv1alpha1.ClusterScan) {
+			raw, err := json.Marshal(old)
+			Expect(err).NotTo(HaveOccurred())
+			ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update, OldObject: runtime.RawExtension{Raw: raw}},
+			})
+			Expect(defaulter.Default(ctx, scan)).To(Succeed())
+		}
+
+		for _, command := range [][]string{
+			nil,
+			// Defaulted from the target by earlier versions of the webhook
+			{"trivy", "image", "--format", "json", "nginx:1.25"},
+		} {
+			scan := &scanv1alpha1.ClusterScan{
+				ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+				Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:latest", Target: "nginx:1.25", Command: command},
+			}
+			Expect(defaulter.Default(context.Background(), scan)).To(Succeed())
+			newReconciler(scan)
+			key := client.ObjectKeyFromObject(scan)
+			latest := reconcile(key)
+			finish("nginx-job")
+			latest = reconcile(key)
+
+			old := latest.DeepCopy()
+			latest.Spec.Target = "nginx:1.27"
+			admit(old, latest)
+			edit(latest, func(*scanv1alpha1.ClusterScanSpec) {})
+			reconcile(key)
+			Expect(jobNames()).To(ConsistOf("nginx-job-g2"))
+			job := &batchv1.Job{}
+			Expect(r.Get(context.Background(), client.ObjectKey{Name: "nginx-job-g2", Namespace: "default"}, job)).To(Succeed())
+			Expect(job.Spec.Template.Spec.Containers[0].Command).To(ContainElement("nginx:1.27"))
+		}
+	})
+
+	It("should keep the Job when the change does not affect the scan", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:latest", Target: "nginx:1.25"},
+		}
+		newReconciler(scan)
+		key := client.ObjectKeyFromObject(scan)
+		latest := reconcile(key)
+		finish("nginx-job")
+
+		maxCritical := int32(0)
+		edit(latest, func(spec *scanv1alpha1.ClusterScanSpec) {
+			spec.FailurePolicy = &scanv1alpha1.FailurePolicy{MaxCritical: &maxCritical}
+		})
+		latest = reconcile(key)
+		Expect(jobNames()).To(ConsistOf("nginx-job"))
+		Expect(latest.Status.ObservedGeneration).To(Equal(int64(2)))
+	})
+
+	It("should scan again when the timeout or retry limit of a completed scan changed", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:latest", Target: "nginx:1.25"},
+		}
+		newReconciler(scan)
+		key := client.ObjectKeyFromObject(scan)
+		latest := reconcile(key)
+		finish("nginx-job")
+		latest = reconcile(key)
+
+		edit(latest, func(spec *scanv1alpha1.ClusterScanSpec) { spec.Timeout = &metav1.Duration{Duration: 2 * time.Hour} })
+		latest = reconcile(key)
+		Expect(jobNames()).To(ConsistOf("nginx-job-g2"))
+		job := &batchv1.Job{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Name: "nginx-job-g2", Namespace: "default"}, job)).To(Succeed())
+		Expect(*job.Spec.ActiveDeadlineSeconds).To(Equal(int64(7200)))
+		finish("nginx-job-g2")
+		latest = reconcile(key)
+
+		retries := int32(1)
+		edit(latest, func(spec *scanv1alpha1.ClusterScanSpec) { spec.MaxRetries = &retries })
+		latest = reconcile(key)
+		Expect(jobNames()).To(ConsistOf("nginx-job-g3"))
+		finish("nginx-job-g3")
+		latest = reconcile(key)
+
+		// The TTL only decides how long finished Jobs are kept, so it is applied without a new run
+		ttl := int32(600)
+		edit(latest, func(spec *scanv1alpha1.ClusterScanSpec) { spec.TTLSecondsAfterFinished = &ttl })
+		reconcile(key)
+		Expect(jobNames()).To(ConsistOf("nginx-job-g3"))
+	})
+
+	It("should update the job template of a scheduled scan whose image changed", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default", Generation: 1},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25", Schedule: "0 2 * * *",
+			},
+		}
+		newReconciler(scan)
+		key := client.ObjectKeyFromObject(scan)
+		latest := reconcile(key)
+
+		edit(latest, func(spec *scanv1alpha1.ClusterScanSpec) { spec.Image = "aquasec/trivy:0.51.0" })
+		latest = reconcile(key)
+		Expect(latest.Status.ObservedGeneration).To(Equal(int64(2)))
+
+		cronJob := &batchv1.CronJob{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Name: "nightly-cron", Namespace: "default"}, cronJob)).To(Succeed())
+		Expect(cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image).To(Equal("aquasec/trivy:0.51.0"))
+	})
+})
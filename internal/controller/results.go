@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+const (
+	// ScannerContainer is the name of the container that runs the scanner in every scan Pod
+	ScannerContainer = "scanner"
+
+	// ResultsVolume is the emptyDir shared by the scanner and its sidecars
+	ResultsVolume = "scan-results"
+
+	resultsPath = "/scan-results"
+)
+
+// scanAttempt is one run of the scanner container in a scan Pod. Restarted containers keep the
+// logs of the instance before the restart, which is read as the previous attempt.
+type scanAttempt struct {
+	pod      *corev1.Pod
+	previous bool
+	exitCode *int32
+}
+
+// applySidecars adds the ClusterScan's sidecars to the scan Pod and mounts the shared results
+// volume into every container
+func applySidecars(clusterScan *scanv1alpha1.ClusterScan, pod *corev1.PodSpec) {
+	if len(clusterScan.Spec.Sidecars) == 0 {
+		return
+	}
+
+	pod.Containers = append(pod.Containers, clusterScan.Spec.DeepCopy().Sidecars...)
+	pod.Volumes = append(pod.Volumes, corev1.Volume{
+		Name:         ResultsVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	for i := range pod.Containers {
+		pod.Containers[i].VolumeMounts = append(pod.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name: ResultsVolume, MountPath: resultsPath,
+		})
+	}
+}
+
+// resultsContainer returns the container whose logs hold the scan output
+func resultsContainer(clusterScan *scanv1alpha1.ClusterScan) string {
+	if clusterScan.Spec.ResultsContainer != "" {
+		return clusterScan.Spec.ResultsContainer
+	}
+	return ScannerContainer
+}
+
+// listJobPods returns a Job's Pods, oldest first with ties broken by name, so attempts are
+// always considered in the same order
+func (r *ClusterScanReconciler) listJobPods(ctx context.Context, job *batchv1.Job) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return nil, fmt.Errorf("unable to list pods: %v", err)
+	}
+	pods := podList.Items
+	sort.Slice(pods, func(i, j int) bool {
+		if !pods[i].CreationTimestamp.Equal(&pods[j].CreationTimestamp) {
+			return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// scannerStatus returns the status of a Pod's scanner container, or nil before it was created
+func scannerStatus(pod *corev1.Pod) *corev1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == ScannerContainer {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// countAttempts counts the times the scanner ran across a Job's Pods, including the restarts
+// RestartPolicyOnFailure makes within a Pod
+func countAttempts(pods []corev1.Pod) int32 {
+	var attempts int32
+	for i := range pods {
+		status := scannerStatus(&pods[i])
+		if status == nil {
+			continue
+		}
+		attempts += status.RestartCount
+		if status.State.Waiting == nil {
+			attempts++
+		}
+	}
+	return attempts
+}
+
+// scanAttempts lists the scanner runs whose logs may still be read, in Pod order. Only the
+// current and the last terminated instance of a container keep their logs.
+func scanAttempts(pods []corev1.Pod) []scanAttempt {
+	var attempts []scanAttempt
+	for i := range pods {
+		pod := &pods[i]
+		status := scannerStatus(pod)
+		if status == nil {
+			// Pods that never reported container statuses may still have logs
+			attempts = append(attempts, scanAttempt{pod: pod})
+			continue
+		}
+		if last := status.LastTerminationState.Terminated; last != nil {
+			exitCode := last.ExitCode
+			attempts = append(attempts, scanAttempt{pod: pod, previous: true, exitCode: &exitCode})
+		}
+		if status.State.Waiting == nil {
+			attempts = append(attempts, scanAttempt{pod: pod, exitCode: scannerExitCode(pod)})
+		}
+	}
+	return attempts
+}
+
+// rankAttempts orders attempts by preference: runs whose exit code completed the scan first,
+// then the rest, newest first within each group. Parallel or retried Jobs thus always report
+// the same run.
+func rankAttempts(attempts []scanAttempt, completed func(exitCode int32) bool) []scanAttempt {
+	ranked := make([]scanAttempt, 0, len(attempts))
+	for _, succeeded := range []bool{true, false} {
+		for i := len(attempts) - 1; i >= 0; i-- {
+			attempt := attempts[i]
+			if (attempt.exitCode != nil && completed(*attempt.exitCode)) == succeeded {
+				ranked = append(ranked, attempt)
+			}
+		}
+	}
+	return ranked
+}
+
+// readAttemptLogs reads the scan output of the most preferred attempt whose logs are still
+// available. A sidecar holding the results is read from the attempt's Pod as it is now, since
+// its restarts do not line up with the scanner's.
+func (r *ClusterScanReconciler) readAttemptLogs(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	pods []corev1.Pod) ([]byte, *scanAttempt, error) {
+	log := ctrl.LoggerFrom(ctx)
+	container := resultsContainer(clusterScan)
+
+	completed := func(exitCode int32) bool {
+		return exitCodeResult(clusterScan, &exitCode) != scanv1alpha1.ResultScannerError
+	}
+
+	var lastErr error
+	for _, attempt := range rankAttempts(scanAttempts(pods), completed) {
+		options := &corev1.PodLogOptions{
+			Container: container,
+			Previous:  attempt.previous && container == ScannerContainer,
+		}
+		logBytes, err := r.KubeClient.CoreV1().Pods(attempt.pod.Namespace).GetLogs(attempt.pod.Name, options).DoRaw(ctx)
+		if err != nil {
+			log.Info("Logs unavailable for scan attempt", "pod", attempt.pod.Name, "previous", options.Previous, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		return logBytes, &attempt, nil
+	}
+	return nil, nil, lastErr
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Scan result collection", func() {
+	created := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	terminated := func(exitCode int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode}}
+	}
+	scanPod := func(name string, offset time.Duration, status corev1.ContainerStatus) corev1.Pod {
+		status.Name = ScannerContainer
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "default", Labels: map[string]string{"job-name": "nginx-job"},
+				CreationTimestamp: metav1.NewTime(created.Add(offset)),
+			},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "uploader", State: terminated(0)},
+				status,
+			}},
+		}
+	}
+
+	// A Pod that failed outright, followed by one whose scanner failed once and then succeeded
+	retried := func() []corev1.Pod {
+		return []corev1.Pod{
+			scanPod("nginx-job-aaaaa", 0, corev1.ContainerStatus{State: terminated(2)}),
+			scanPod("nginx-job-bbbbb", time.Minute, corev1.ContainerStatus{
+				RestartCount: 1, State: terminated(0), LastTerminationState: terminated(1),
+			}),
+		}
+	}
+
+	It("should count every Pod and container restart as an attempt", func() {
+		Expect(countAttempts(retried())).To(Equal(int32(3)))
+
+		waiting := scanPod("nginx-job-ccccc", 0, corev1.ContainerStatus{
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		})
+		Expect(countAttempts([]corev1.Pod{waiting})).To(BeZero())
+	})
+
+	It("should prefer the newest successful attempt over failed and previous ones", func() {
+		ranked := rankAttempts(scanAttempts(retried()), func(exitCode int32) bool { return exitCode == 0 })
+		Expect(ranked).To(HaveLen(3))
+		Expect(ranked[0].pod.Name).To(Equal("nginx-job-bbbbb"))
+		Expect(ranked[0].previous).To(BeFalse())
+		Expect(ranked[0].exitCode).To(HaveValue(Equal(int32(0))))
+		Expect(ranked[1].previous).To(BeTrue())
+		Expect(ranked[2].pod.Name).To(Equal("nginx-job-aaaaa"))
+	})
+
+	It("should pick the same Pod of a parallel Job whatever order the Pods are listed in", func() {
+		first := scanPod("nginx-job-xxxxx", 0, corev1.ContainerStatus{State: terminated(0)})
+		second := scanPod("nginx-job-yyyyy", 0, corev1.ContainerStatus{State: terminated(0)})
+		for _, pods := range [][]corev1.Pod{{first, second}, {second, first}} {
+			Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&pods[0], &pods[1]).Build()
+			r := &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme}
+			listed, err := r.listJobPods(context.Background(), &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "nginx-job", Namespace: "default"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			ranked := rankAttempts(scanAttempts(listed), func(exitCode int32) bool { return exitCode == 0 })
+			Expect(ranked[0].pod.Name).To(Equal("nginx-job-yyyyy"))
+		}
+	})
+
+	It("should record the attempts and the successful attempt's exit code", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25"},
+		}
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job", Namespace: "default"},
+			Status:     batchv1.JobStatus{Succeeded: 1},
+		}
+		pods := retried()
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(scan, job, &pods[0], &pods[1]).Build()
+		r := &ClusterScanReconciler{
+			Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20),
+			KubeClient: kubefake.NewSimpleClientset(),
+		}
+
+		report, err := r.recordRun(context.Background(), scan, job, RunSucceeded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).NotTo(BeNil())
+		Expect(report.Spec.ExitCode).To(HaveValue(Equal(int32(0))))
+		Expect(scan.Status.History).To(HaveLen(1))
+		Expect(scan.Status.History[0].Attempts).To(Equal(int32(3)))
+		Expect(scan.Status.History[0].ExitCode).To(HaveValue(Equal(int32(0))))
+	})
+
+	It("should share a results volume between the scanner and its sidecars", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:            "aquasec/trivy:0.50.0",
+				Command:          []string{"trivy", "image", "--format", "json", "--output", "/scan-results/report.json", "nginx:1.25"},
+				Sidecars:         []corev1.Container{{Name: "uploader", Image: "busybox:1.36"}},
+				ResultsContainer: "uploader",
+			},
+		}
+		pod := scanPodTemplate(scan).Spec
+		Expect(pod.Containers).To(HaveLen(2))
+		Expect(pod.Containers[0].Name).To(Equal(ScannerContainer))
+		Expect(pod.Volumes).To(ContainElement(HaveField("Name", ResultsVolume)))
+		for _, container := range pod.Containers {
+			Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: ResultsVolume, MountPath: resultsPath}))
+		}
+		Expect(scan.Spec.Sidecars[0].VolumeMounts).To(BeEmpty())
+		Expect(resultsContainer(scan)).To(Equal("uploader"))
+	})
+})
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// RunNowAnnotation requests an immediate run of a ClusterScan. Each new value, e.g. a timestamp,
+// starts one run; the value last acted on is recorded in status.lastRunNowToken.
+const RunNowAnnotation = "scan.ahmali3.github.io/run-now"
+
+// runNowToken returns the run-now token the ClusterScan has not acted on yet, or ""
+func runNowToken(clusterScan *scanv1alpha1.ClusterScan) string {
+	token := clusterScan.Annotations[RunNowAnnotation]
+	if token == clusterScan.Status.LastRunNowToken {
+		return ""
+	}
+	return token
+}
+
+// tokenSuffix derives a Job name suffix from a run-now token, which may contain any characters
+func tokenSuffix(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// oneOffJobName returns the Job of a one-off scan's current run. Every run-now token names a
+// new Job, so the scan runs again instead of finding its finished Job.
+func oneOffJobName(clusterScan *scanv1alpha1.ClusterScan) string {
+	name := clusterScan.Name + "-job"
+	if token := clusterScan.Annotations[RunNowAnnotation]; token != "" {
+		name += "-" + tokenSuffix(token)
+	}
+	return name
+}
+
+// manualJobName returns the Job a run-now token starts for a scheduled scan
+func manualJobName(clusterScan *scanv1alpha1.ClusterScan, token string) string {
+	return fmt.Sprintf("%s-manual-%s", clusterScan.Name, tokenSuffix(token))
+}
+
+// runNow creates an ad-hoc Job from the CronJob's template when the ClusterScan carries a new
+// run-now token, like kubectl create job --from=cronjob. The Job is owned by the ClusterScan and
+// labelled like scheduled Jobs, so it is recorded with them. The caller persists the status.
+func (r *ClusterScanReconciler) runNow(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	cronJob *batchv1.CronJob) error {
+	token := runNowToken(clusterScan)
+	if token == "" {
+		return nil
+	}
+
+	template := cronJob.Spec.JobTemplate.DeepCopy()
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        manualJobName(clusterScan, token),
+			Namespace:   clusterScan.Namespace,
+			Labels:      template.Labels,
+			Annotations: template.Annotations,
+		},
+		Spec: template.Spec,
+	}
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[ScanNameLabel] = clusterScan.Name
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations["cronjob.kubernetes.io/instantiate"] = "manual"
+
+	if err := controllerutil.SetControllerReference(clusterScan, job, r.Scheme); err != nil {
+		return err
+	}
+	// The Job exists already when the status update after an earlier attempt failed
+	if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create run-now job: %v", err)
+	}
+	r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "RunNow", "Manual scan run %s created", job.Name)
+
+	// The CronJob's history limits do not apply to Jobs it does not own
+	if previous := clusterScan.Status.LastRunNowToken; previous != "" {
+		if err := r.deleteCollectedJob(ctx, clusterScan.Namespace, manualJobName(clusterScan, previous)); err != nil {
+			return err
+		}
+	}
+
+	clusterScan.Status.LastRunNowToken = token
+	clusterScan.Status.LastJobName = job.Name
+	return nil
+}
+
+// deleteCollectedJob removes a previous run's Job once its outcome has been recorded. Its
+// ScanReport and history entry are kept.
+func (r *ClusterScanReconciler) deleteCollectedJob(ctx context.Context, namespace, name string) error {
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, job); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if job.Labels[CollectedLabel] != "true" {
+		return nil
+	}
+	if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return nil
+}
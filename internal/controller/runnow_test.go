@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Run now", func() {
+	var r *ClusterScanReconciler
+
+	newReconciler := func(objs ...client.Object) {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(objs...).WithStatusSubresource(&scanv1alpha1.ClusterScan{}).Build()
+		r = &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20)}
+	}
+
+	reconcile := func(scan *scanv1alpha1.ClusterScan) *scanv1alpha1.ClusterScan {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(scan)})
+		Expect(err).NotTo(HaveOccurred())
+		latest := &scanv1alpha1.ClusterScan{}
+		Expect(r.Get(context.Background(), client.ObjectKeyFromObject(scan), latest)).To(Succeed())
+		return latest
+	}
+
+	jobNames := func() []string {
+		jobs := &batchv1.JobList{}
+		Expect(r.List(context.Background(), jobs)).To(Succeed())
+		var names []string
+		for _, job := range jobs.Items {
+			names = append(names, job.Name)
+		}
+		return names
+	}
+
+	It("should re-run a finished one-off scan in a new Job", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "nginx", Namespace: "default",
+				Annotations: map[string]string{RunNowAnnotation: "2026-01-01T00:00:00Z"},
+			},
+			Spec:   scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:latest", Target: "nginx:1.25"},
+			Status: scanv1alpha1.ClusterScanStatus{LastJobName: "nginx-job", Phase: PhaseCompleted},
+		}
+		finished := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "nginx-job", Namespace: "default",
+				Labels: map[string]string{ScanNameLabel: "nginx", CollectedLabel: "true"},
+			},
+			Status: batchv1.JobStatus{Succeeded: 1},
+		}
+		newReconciler(scan, finished)
+
+		latest := reconcile(scan)
+		jobName := "nginx-job-" + tokenSuffix("2026-01-01T00:00:00Z")
+		Expect(jobNames()).To(ConsistOf(jobName))
+		Expect(latest.Status.Phase).To(Equal(PhaseRunning))
+		Expect(latest.Status.LastJobName).To(Equal(jobName))
+		Expect(latest.Status.LastRunNowToken).To(Equal("2026-01-01T00:00:00Z"))
+
+		// The same token does not start another run
+		reconcile(latest)
+		Expect(jobNames()).To(ConsistOf(jobName))
+	})
+
+	It("should create an ad-hoc Job from the CronJob template of a scheduled scan", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image: "aquasec/trivy:latest", Target: "nginx:1.25", Schedule: "0 2 * * *",
+			},
+		}
+		newReconciler(scan)
+		latest := reconcile(scan)
+		Expect(latest.Status.Phase).To(Equal(PhaseScheduled))
+		Expect(jobNames()).To(BeEmpty())
+
+		latest.Annotations = map[string]string{RunNowAnnotation: "first"}
+		Expect(r.Update(context.Background(), latest)).To(Succeed())
+		latest = reconcile(latest)
+
+		jobName := manualJobName(latest, "first")
+		Expect(jobNames()).To(ConsistOf(jobName))
+		Expect(latest.Status.Phase).To(Equal(PhaseRunning))
+		Expect(latest.Status.LastJobName).To(Equal(jobName))
+		Expect(latest.Status.LastRunNowToken).To(Equal("first"))
+
+		job := &batchv1.Job{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Name: jobName, Namespace: "default"}, job)).To(Succeed())
+		Expect(job.Labels).To(HaveKeyWithValue(ScanNameLabel, "nightly"))
+		Expect(job.Annotations).To(HaveKeyWithValue("cronjob.kubernetes.io/instantiate", "manual"))
+		Expect(metav1.IsControlledBy(job, latest)).To(BeTrue())
+		Expect(job.Spec.Template.Spec.Containers[0].Command).To(ContainElement("nginx:1.25"))
+
+		reconcile(latest)
+		Expect(jobNames()).To(ConsistOf(jobName))
+	})
+})
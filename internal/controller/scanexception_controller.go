@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/resultstore"
+)
+
+// ScanExceptionReconciler marks ScanExceptions as expired once their expiry passes, and
+// re-evaluates the ScanReports in their namespace whenever they change
+type ScanExceptionReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// ResultStore holds the raw scanner output reports are re-evaluated from; ConfigMaps are
+	// used when unset
+	ResultStore resultstore.Store
+}
+
+// +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=scanexceptions,verbs=get;list;watch
+// +kubebuilder:rbac:groups=scan.ahmali3.github.io,resources=scanexceptions/status,verbs=get;update;patch
+
+func (r *ScanExceptionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	exception := &scanv1alpha1.ScanException{}
+	store := defaultResultStore(r.ResultStore, r.Client, r.Scheme)
+	if err := r.Get(ctx, req.NamespacedName, exception); errors.IsNotFound(err) {
+		// A deleted exception no longer suppresses findings
+		return ctrl.Result{}, reevaluateReports(ctx, r.Client, store, req.Namespace)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	result, err := reconcileExceptionExpiry(ctx, r.Client, r.Recorder, exception, &exception.Spec, &exception.Status)
+	if err != nil {
+		return result, err
+	}
+	return result, reevaluateReports(ctx, r.Client, store, req.Namespace)
+}
+
+func (r *ScanExceptionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates, such as marking an exception expired, need no re-evaluation
+		For(&scanv1alpha1.ScanException{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// reconcileExceptionExpiry requeues an exception until it expires, then records the expiry
+// in its status and emits an event once
+func reconcileExceptionExpiry(ctx context.Context, c client.Client, recorder record.EventRecorder,
+	obj client.Object, spec *scanv1alpha1.ScanExceptionSpec, status *scanv1alpha1.ScanExceptionStatus) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	now := time.Now()
+	expired := exceptionExpired(spec, now)
+	if !expired {
+		if status.Expired {
+			// The expiry was extended
+			status.Expired = false
+			if err := c.Status().Update(ctx, obj); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if spec.ExpiresAt == nil {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{RequeueAfter: spec.ExpiresAt.Sub(now)}, nil
+	}
+
+	if status.Expired {
+		return ctrl.Result{}, nil
+	}
+	status.Expired = true
+	if err := c.Status().Update(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Info("Scan exception expired", "expiresAt", spec.ExpiresAt)
+	recorder.Event(obj, corev1.EventTypeWarning, "ExceptionExpired",
+		fmt.Sprintf("Exception expired at %s; matching findings are reported again from the next scan",
+			spec.ExpiresAt.Format(time.RFC3339)))
+	return ctrl.Result{}, nil
+}
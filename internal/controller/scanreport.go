@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
+)
+
+// maxReportFindings bounds the size of a ScanReport, since etcd rejects objects above ~1.5MiB.
+// The summary always covers every finding.
+const maxReportFindings = 1000
+
+// buildScanReport parses the scanner output of a completed Job into a ScanReport, leaving out
+// findings accepted by exceptions. The returned summary is nil when no parser is available for
+// the scanner or its output could not be parsed.
+func (r *ClusterScanReconciler) buildScanReport(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan,
+	job *batchv1.Job, output []byte, exceptions []scanException) (*scanv1alpha1.ScanReport, *scanv1alpha1.VulnerabilitySummary) {
+	log := ctrl.LoggerFrom(ctx)
+
+	scannerType := scanner.DetectType(clusterScan.Spec.Image)
+	target := jobTarget(clusterScan, job)
+	report := &scanv1alpha1.ScanReport{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: clusterScan.Namespace,
+			Labels: map[string]string{
+				"app":         "clusterscan",
+				ScanNameLabel: clusterScan.Name,
+			},
+		},
+		Spec: scanv1alpha1.ScanReportSpec{
+			ScanName:       clusterScan.Name,
+			JobName:        job.Name,
+			Scanner:        scanv1alpha1.ScannerInfo{Type: scannerType, Image: clusterScan.Spec.Image},
+			Target:         target,
+			TargetDigest:   digestOf(target),
+			NodeName:       jobNode(job),
+			StartTime:      job.Status.StartTime,
+			CompletionTime: job.Status.CompletionTime,
+		},
+	}
+
+	parser, ok := parserFor(scannerType)
+	if !ok {
+		return report, nil
+	}
+
+	parsed, err := parser.Parse(output)
+	if err != nil {
+		log.Info("Unable to parse scan output", "scanner", scannerType, "reason", err.Error())
+		r.Recorder.Event(clusterScan, corev1.EventTypeWarning, "ParseFailed",
+			fmt.Sprintf("Could not parse %s output: %v", scannerType, err))
+		return report, nil
+	}
+
+	if parsed.ArtifactDigest != "" {
+		report.Spec.TargetDigest = parsed.ArtifactDigest
+	}
+	report.Spec.Scanner.DBVersion = parsed.DBVersion
+	return report, evaluateFindings(clusterScan, report, parsed.Findings, exceptions)
+}
+
+// evaluateFindings records a report's parsed findings, leaving out those accepted by exceptions,
+// and checks the rest against the ClusterScan's failure policy. It returns the report's summary.
+func evaluateFindings(clusterScan *scanv1alpha1.ClusterScan, report *scanv1alpha1.ScanReport,
+	findings []scanv1alpha1.Finding, exceptions []scanException) *scanv1alpha1.VulnerabilitySummary {
+	findings, suppressed, applied := applyExceptions(exceptions, findings, report.Spec.Scanner.Type, report.Spec.Target)
+	report.Spec.AppliedExceptions = applied
+
+	summary := summarizeFindings(findings)
+	summary.Suppressed = suppressed
+	report.Spec.Summary = *summary
+	report.Spec.PolicyViolations = evaluateFailurePolicy(clusterScan.Spec.FailurePolicy, findings)
+
+	sortFindings(findings)
+	report.Spec.FindingsTruncated = len(findings) > maxReportFindings
+	if report.Spec.FindingsTruncated {
+		findings = findings[:maxReportFindings]
+	}
+	report.Spec.Findings = findings
+	return summary
+}
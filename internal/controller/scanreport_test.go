@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("ScanReport construction", func() {
+	var (
+		reconciler *ClusterScanReconciler
+		scan       *scanv1alpha1.ClusterScan
+		job        *batchv1.Job
+	)
+
+	BeforeEach(func() {
+		reconciler = &ClusterScanReconciler{Recorder: record.NewFakeRecorder(10)}
+		scan = &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "report-scan", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:  "aquasec/trivy:0.48.0",
+				Target: "nginx@sha256:1111",
+			},
+		}
+		now := metav1.Now()
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "report-scan-job", Namespace: "default"},
+			Status:     batchv1.JobStatus{StartTime: &now, CompletionTime: &now},
+		}
+	})
+
+	It("should record scanner metadata, run timestamps and findings", func() {
+		report, summary := reconciler.buildScanReport(context.Background(), scan, job, []byte(trivyOutput), nil)
+
+		Expect(report.Name).To(Equal("report-scan-job"))
+		Expect(report.Labels).To(HaveKeyWithValue(ScanNameLabel, "report-scan"))
+		Expect(report.Spec.Scanner).To(Equal(scanv1alpha1.ScannerInfo{Type: "trivy", Image: "aquasec/trivy:0.48.0"}))
+		Expect(report.Spec.CompletionTime).To(Equal(job.Status.CompletionTime))
+		Expect(report.Spec.TargetDigest).To(HavePrefix("sha256:df13abe4"))
+		Expect(report.Spec.Findings).To(HaveLen(6))
+		Expect(report.Spec.Findings[0].Severity).To(Equal(SeverityCritical))
+		Expect(summary).NotTo(BeNil())
+		Expect(report.Spec.Summary).To(Equal(*summary))
+	})
+
+	It("should fall back to the digest in the target reference", func() {
+		report, summary := reconciler.buildScanReport(context.Background(), scan, job, []byte("not json"), nil)
+		Expect(summary).To(BeNil())
+		Expect(report.Spec.TargetDigest).To(Equal("sha256:1111"))
+		Expect(report.Spec.Findings).To(BeEmpty())
+	})
+
+	It("should keep only the most severe findings when there are too many", func() {
+		var vulns []string
+		for i := 0; i < maxReportFindings+5; i++ {
+			severity := "LOW"
+			if i == maxReportFindings+4 {
+				severity = "CRITICAL"
+			}
+			vulns = append(vulns, fmt.Sprintf(`{"VulnerabilityID": "CVE-%05d", "Severity": %q}`, i, severity))
+		}
+		output := `{"Results": [{"Target": "big", "Vulnerabilities": [` + strings.Join(vulns, ",") + `]}]}`
+
+		report, summary := reconciler.buildScanReport(context.Background(), scan, job, []byte(output), nil)
+		Expect(report.Spec.FindingsTruncated).To(BeTrue())
+		Expect(report.Spec.Findings).To(HaveLen(maxReportFindings))
+		Expect(report.Spec.Findings[0].Severity).To(Equal(SeverityCritical))
+		Expect(summary.Low).To(Equal(int32(maxReportFindings + 4)))
+	})
+})
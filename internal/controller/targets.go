@@ -0,0 +1,423 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// TargetAnnotation records the image a fanned-out scan Job scans
+const TargetAnnotation = "scan.ahmali3.github.io/target"
+
+// TargetEnvVar holds the image to scan in fanned-out Jobs, so custom commands can use $(SCAN_TARGET)
+const TargetEnvVar = "SCAN_TARGET"
+
+const defaultMaxConcurrentScans int32 = 5
+
+// discoveredImage is a unique image found in the selected workloads
+type discoveredImage struct {
+	Image  string
+	Digest string
+}
+
+// jobTarget returns the image a Job scans: its target annotation for fanned-out Jobs,
+// otherwise the ClusterScan's target
+func jobTarget(clusterScan *scanv1alpha1.ClusterScan, job *batchv1.Job) string {
+	if target, ok := job.Annotations[TargetAnnotation]; ok {
+		return target
+	}
+	return clusterScan.Spec.Target
+}
+
+// targetJobName derives a stable Job name for an image and, when known, its digest, since image
+// references are not valid names
+func targetJobName(clusterScan *scanv1alpha1.ClusterScan, image, digest string) string {
+	if digest != "" {
+		image += "@" + digest
+	}
+	sum := sha256.Sum256([]byte(image))
+	return fmt.Sprintf("%s-%s", clusterScan.Name, hex.EncodeToString(sum[:])[:10])
+}
+
+// discoverImages lists the unique images used by the workloads a TargetSelector selects
+func (r *ClusterScanReconciler) discoverImages(ctx context.Context, selector *scanv1alpha1.TargetSelector) ([]discoveredImage, error) {
+	labelSelector := labels.Everything()
+	if selector.LabelSelector != nil {
+		var err error
+		if labelSelector, err = metav1.LabelSelectorAsSelector(selector.LabelSelector); err != nil {
+			return nil, fmt.Errorf("invalid label selector: %v", err)
+		}
+	}
+
+	kinds := map[string]bool{}
+	for _, kind := range selector.Kinds {
+		kinds[kind] = true
+	}
+	wants := func(kind string) bool { return len(kinds) == 0 || kinds[kind] }
+
+	namespaces := selector.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	found := map[string]string{}
+	addPodSpec := func(spec *corev1.PodSpec) {
+		for _, c := range append(spec.InitContainers, spec.Containers...) {
+			if _, ok := found[c.Image]; !ok {
+				found[c.Image] = ""
+			}
+		}
+	}
+
+	for _, namespace := range namespaces {
+		opts := []client.ListOption{client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: labelSelector}}
+
+		if wants(scanv1alpha1.WorkloadPod) {
+			pods := &corev1.PodList{}
+			if err := r.List(ctx, pods, opts...); err != nil {
+				return nil, fmt.Errorf("unable to list pods: %v", err)
+			}
+			for i := range pods.Items {
+				pod := &pods.Items[i]
+				// Skip scanner pods so a scan never discovers its own Jobs
+				if pod.Status.Phase != corev1.PodRunning || pod.Labels[ScanNameLabel] != "" {
+					continue
+				}
+				addPodSpec(&pod.Spec)
+				for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+					for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+						if c.Name == status.Name && found[c.Image] == "" {
+							found[c.Image] = digestOf(status.ImageID)
+						}
+					}
+				}
+			}
+		}
+
+		if wants(scanv1alpha1.WorkloadDeployment) {
+			deployments := &appsv1.DeploymentList{}
+			if err := r.List(ctx, deployments, opts...); err != nil {
+				return nil, fmt.Errorf("unable to list deployments: %v", err)
+			}
+			for i := range deployments.Items {
+				addPodSpec(&deployments.Items[i].Spec.Template.Spec)
+			}
+		}
+
+		if wants(scanv1alpha1.WorkloadStatefulSet) {
+			statefulSets := &appsv1.StatefulSetList{}
+			if err := r.List(ctx, statefulSets, opts...); err != nil {
+				return nil, fmt.Errorf("unable to list statefulsets: %v", err)
+			}
+			for i := range statefulSets.Items {
+				addPodSpec(&statefulSets.Items[i].Spec.Template.Spec)
+			}
+		}
+
+		if wants(scanv1alpha1.WorkloadDaemonSet) {
+			daemonSets := &appsv1.DaemonSetList{}
+			if err := r.List(ctx, daemonSets, opts...); err != nil {
+				return nil, fmt.Errorf("unable to list daemonsets: %v", err)
+			}
+			for i := range daemonSets.Items {
+				addPodSpec(&daemonSets.Items[i].Spec.Template.Spec)
+			}
+		}
+	}
+
+	images := make([]discoveredImage, 0, len(found))
+	for image, digest := range found {
+		images = append(images, discoveredImage{Image: image, Digest: digest})
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Image < images[j].Image })
+	return images, nil
+}
+
+// reconcileTargets discovers the images selected by the TargetSelector on the first reconcile,
+// or on every reconcile in watch mode, then runs one scan Job per image, at most
+// MaxConcurrentScans at a time, and aggregates their results into the ClusterScan status
+func (r *ClusterScanReconciler) reconcileTargets(ctx context.Context, clusterScan *scanv1alpha1.ClusterScan) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	watch := clusterScan.Spec.TargetSelector.Watch
+	if watch || (len(clusterScan.Status.Targets) == 0 && (clusterScan.Status.Phase == "" || clusterScan.Status.Phase == PhasePending)) {
+		images, err := r.discoverImages(ctx, clusterScan.Spec.TargetSelector)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		targets, added, replaced := mergeTargets(clusterScan.Status.Targets, images)
+		clusterScan.Status.Targets = targets
+		if len(added) > 0 || clusterScan.Status.Phase == "" {
+			log.Info("Discovered images for target selector", "count", len(images), "new", len(added))
+			r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "TargetsDiscovered", "Discovered %d images to scan", len(added))
+		}
+		if watch && clusterScan.Status.Phase != "" {
+			for _, image := range added {
+				r.Recorder.Eventf(clusterScan, corev1.EventTypeNormal, "ImageChanged", "Scanning new image %s", image)
+			}
+		}
+		// Scans of a digest that is no longer running are superseded by the scan of its replacement
+		for _, jobName := range replaced {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: jobName, Namespace: clusterScan.Namespace}}
+			if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to delete superseded Job %s: %v", jobName, err)
+			}
+		}
+	}
+
+	jobList := &batchv1.JobList{}
+	if err := r.List(ctx, jobList, client.InNamespace(clusterScan.Namespace),
+		client.MatchingLabels{ScanNameLabel: clusterScan.Name}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to list jobs: %v", err)
+	}
+	jobs := map[string]*batchv1.Job{}
+	for i := range jobList.Items {
+		jobs[jobList.Items[i].Name] = &jobList.Items[i]
+	}
+	targetJob := func(target *scanv1alpha1.TargetStatus) (*batchv1.Job, bool) {
+		name := target.JobName
+		if name == "" {
+			name = targetJobName(clusterScan, target.Image, target.Digest)
+		}
+		job, ok := jobs[name]
+		return job, ok
+	}
+
+	maxConcurrent := defaultMaxConcurrentScans
+	if limit := clusterScan.Spec.TargetSelector.MaxConcurrentScans; limit != nil && *limit > 0 {
+		maxConcurrent = *limit
+	}
+	var running int32
+	for i := range clusterScan.Status.Targets {
+		if job, ok := targetJob(&clusterScan.Status.Targets[i]); ok {
+			if _, finished := jobOutcome(job); !finished {
+				running++
+			}
+		}
+	}
+
+	var collected []*batchv1.Job
+	for i := range clusterScan.Status.Targets {
+		target := &clusterScan.Status.Targets[i]
+		job, ok := targetJob(target)
+		if !ok {
+			if target.Phase != PhasePending {
+				continue
+			}
+			jobName := targetJobName(clusterScan, target.Image, target.Digest)
+			report, err := r.reuseCachedResult(ctx, clusterScan, jobName, target.Image, target.Digest)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if report != nil {
+				recordCachedRun(clusterScan, report)
+				summary := report.Spec.Summary
+				target.Report = report.Name
+				target.Summary = &summary
+				target.CachedFrom = report.Spec.CachedFrom
+				target.Phase = PhaseCompleted
+				if len(report.Spec.PolicyViolations) > 0 {
+					target.Phase = PhasePolicyViolated
+				}
+				continue
+			}
+			if running >= maxConcurrent {
+				continue
+			}
+			job = r.constructTargetJob(clusterScan, jobName, target.Image)
+			if err := controllerutil.SetControllerReference(clusterScan, job, r.Scheme); err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := r.Create(ctx, job); client.IgnoreAlreadyExists(err) != nil {
+				return ctrl.Result{}, err
+			}
+			target.JobName = job.Name
+			target.Phase = PhaseRunning
+			running++
+			continue
+		}
+
+		target.JobName = job.Name
+		outcome, finished := jobOutcome(job)
+		if !finished {
+			if _, err := r.observeActiveJob(ctx, job); err != nil {
+				return ctrl.Result{}, err
+			}
+			target.Phase = PhaseRunning
+			continue
+		}
+		if !needsCollection(clusterScan, job) {
+			continue
+		}
+		report, err := r.recordRun(ctx, clusterScan, job, outcome)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		collected = append(collected, job)
+		target.Phase = PhaseCompleted
+		if outcome != RunSucceeded {
+			target.Phase = PhaseFailed
+		}
+		if report != nil {
+			summary := report.Spec.Summary
+			target.Report = report.Name
+			target.Summary = &summary
+			if len(report.Spec.PolicyViolations) > 0 {
+				target.Phase = PhasePolicyViolated
+			}
+		}
+	}
+
+	aggregateTargets(clusterScan)
+	clusterScan.Status.ObservedGeneration = clusterScan.Generation
+
+	if err := r.Status().Update(ctx, clusterScan); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.markCollected(ctx, clusterScan, collected...); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.pruneReports(ctx, clusterScan); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// mergeTargets folds newly discovered images into the existing targets. Images not seen before,
+// and images now running a different digest, become Pending targets; the names of the Jobs that
+// scanned replaced digests are returned. Finished targets whose image is gone are dropped.
+func mergeTargets(targets []scanv1alpha1.TargetStatus, images []discoveredImage) (
+	merged []scanv1alpha1.TargetStatus, added []string, replaced []string) {
+	existing := map[string]scanv1alpha1.TargetStatus{}
+	for _, target := range targets {
+		existing[target.Image] = target
+	}
+
+	discovered := map[string]bool{}
+	for _, image := range images {
+		discovered[image.Image] = true
+		target, ok := existing[image.Image]
+		switch {
+		case !ok:
+			added = append(added, image.Image)
+		case image.Digest != "" && target.Digest != "" && image.Digest != target.Digest:
+			if target.JobName != "" {
+				replaced = append(replaced, target.JobName)
+			}
+			added = append(added, image.Image+"@"+image.Digest)
+		default:
+			// Workload templates carry no digest until a Pod runs the image
+			if target.Digest == "" {
+				target.Digest = image.Digest
+			}
+			merged = append(merged, target)
+			continue
+		}
+		merged = append(merged, scanv1alpha1.TargetStatus{Image: image.Image, Digest: image.Digest, Phase: PhasePending})
+	}
+
+	for _, target := range targets {
+		if !discovered[target.Image] && (target.Phase == PhasePending || target.Phase == PhaseRunning) {
+			merged = append(merged, target)
+		}
+	}
+	return merged, added, replaced
+}
+
+// constructTargetJob builds the scan Job for one discovered image
+func (r *ClusterScanReconciler) constructTargetJob(clusterScan *scanv1alpha1.ClusterScan, name, image string) *batchv1.Job {
+	job := r.constructJob(clusterScan, name)
+	job.Annotations = map[string]string{TargetAnnotation: image}
+	container := scannerContainer(&job.Spec.Template.Spec)
+	container.Env = append(container.Env, corev1.EnvVar{Name: TargetEnvVar, Value: image})
+	container.Env = append(container.Env, registryAuthorityEnv(clusterScan, image)...)
+	return job
+}
+
+// aggregateTargets sums the per-image results into the ClusterScan summary, phase and conditions
+func aggregateTargets(clusterScan *scanv1alpha1.ClusterScan) {
+	total := &scanv1alpha1.VulnerabilitySummary{}
+	seen := map[string]bool{}
+	var pending, running, failed, violated int
+	var violations []string
+	for _, target := range clusterScan.Status.Targets {
+		switch target.Phase {
+		case PhasePending:
+			pending++
+		case PhaseRunning:
+			running++
+		case PhaseFailed:
+			failed++
+		case PhasePolicyViolated:
+			violated++
+			violations = append(violations, fmt.Sprintf("%s exceeded the failure policy", target.Image))
+		}
+		addSummary(total, target.Summary, seen)
+	}
+	clusterScan.Status.Summary = total
+
+	count := len(clusterScan.Status.Targets)
+	condition := metav1.Condition{Type: ConditionReady}
+	switch {
+	case count == 0:
+		clusterScan.Status.Phase = PhaseCompleted
+		condition.Status, condition.Reason = metav1.ConditionTrue, "NoTargets"
+		condition.Message = "No running images matched the target selector"
+	case pending+running > 0:
+		clusterScan.Status.Phase = PhaseRunning
+		condition.Status, condition.Reason = metav1.ConditionFalse, "Running"
+		condition.Message = fmt.Sprintf("Scanned %d of %d images", count-pending-running, count)
+	case failed > 0:
+		clusterScan.Status.Phase = PhaseFailed
+		condition.Status, condition.Reason = metav1.ConditionFalse, "Failed"
+		condition.Message = fmt.Sprintf("%d of %d image scans failed", failed, count)
+	default:
+		clusterScan.Status.Phase = PhaseCompleted
+		if violated > 0 {
+			clusterScan.Status.Phase = PhasePolicyViolated
+		}
+		condition.Status, condition.Reason = metav1.ConditionTrue, "Completed"
+		condition.Message = fmt.Sprintf("Scanned %d images", count)
+	}
+	meta.SetStatusCondition(&clusterScan.Status.Conditions, condition)
+
+	if pending+running == 0 {
+		setPolicyCondition(clusterScan, violations, true)
+	}
+}
+
+// addSummary adds the counts of s, which may be nil, to total. seen tracks the IDs already in
+// total's TopCVEs.
+func addSummary(total, s *scanv1alpha1.VulnerabilitySummary, seen map[string]bool) {
+	if s == nil {
+		return
+	}
+	total.Critical += s.Critical
+	total.High += s.High
+	total.Medium += s.Medium
+	total.Low += s.Low
+	total.Unknown += s.Unknown
+	total.Fixable += s.Fixable
+	total.Suppressed += s.Suppressed
+	for _, id := range s.TopCVEs {
+		if !seen[id] && len(total.TopCVEs) < maxTopCVEs {
+			seen[id] = true
+			total.TopCVEs = append(total.TopCVEs, id)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Target selector", func() {
+	runningPod := func(namespace, name, image, imageID string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ImageID: imageID}},
+			},
+		}
+	}
+
+	newReconciler := func(objs ...client.Object) *ClusterScanReconciler {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(objs...).WithStatusSubresource(&scanv1alpha1.ClusterScan{}).Build()
+		return &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20)}
+	}
+
+	It("should discover unique images from pods and workload templates", func() {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps", Labels: map[string]string{"team": "a"}},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init", Image: "busybox:1.36"}},
+				Containers:     []corev1.Container{{Name: "web", Image: "nginx:1.25"}},
+			}}},
+		}
+		r := newReconciler(
+			deployment,
+			runningPod("apps", "web-1", "nginx:1.25", "docker.io/library/nginx@sha256:abc", map[string]string{"team": "a"}),
+			runningPod("apps", "scan-1", "aquasec/trivy:0.50.0", "", map[string]string{"team": "a", ScanNameLabel: "scan"}),
+			runningPod("apps", "other", "redis:7", "", map[string]string{"team": "b"}),
+			runningPod("elsewhere", "db", "postgres:16", "", map[string]string{"team": "a"}),
+		)
+
+		images, err := r.discoverImages(context.Background(), &scanv1alpha1.TargetSelector{
+			Namespaces:    []string{"apps"},
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(Equal([]discoveredImage{
+			{Image: "busybox:1.36"},
+			{Image: "nginx:1.25", Digest: "sha256:abc"},
+		}))
+
+		images, err = r.discoverImages(context.Background(), &scanv1alpha1.TargetSelector{Kinds: []string{scanv1alpha1.WorkloadPod}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(HaveLen(3))
+	})
+
+	It("should create at most maxConcurrentScans Jobs, each scanning one image", func() {
+		two := int32(2)
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "fleet", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:          "aquasec/trivy:0.50.0",
+				TargetSelector: &scanv1alpha1.TargetSelector{Namespaces: []string{"apps"}, MaxConcurrentScans: &two},
+			},
+		}
+		r := newReconciler(scan,
+			runningPod("apps", "a", "nginx:1.25", "", nil),
+			runningPod("apps", "b", "redis:7", "", nil),
+			runningPod("apps", "c", "postgres:16", "", nil),
+		)
+
+		_, err := r.reconcileTargets(context.Background(), scan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scan.Status.Targets).To(HaveLen(3))
+		Expect(scan.Status.Phase).To(Equal(PhaseRunning))
+
+		jobs := &batchv1.JobList{}
+		Expect(r.List(context.Background(), jobs, client.InNamespace("default"))).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(2))
+		for _, job := range jobs.Items {
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Command).To(Equal([]string{"trivy", "image", "--format", "json", "$(SCAN_TARGET)"}))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: TargetEnvVar, Value: job.Annotations[TargetAnnotation]}))
+			Expect(job.Spec.Template.Labels).To(HaveKeyWithValue(ScanNameLabel, "fleet"))
+		}
+	})
+
+	It("should complete immediately when no images match", func() {
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:          "aquasec/trivy:0.50.0",
+				TargetSelector: &scanv1alpha1.TargetSelector{Namespaces: []string{"nothing-here"}},
+			},
+		}
+		r := newReconciler(scan)
+
+		_, err := r.reconcileTargets(context.Background(), scan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scan.Status.Phase).To(Equal(PhaseCompleted))
+		Expect(scan.Status.Conditions).To(ContainElement(HaveField("Reason", "NoTargets")))
+	})
+
+	It("should aggregate per-image results", func() {
+		zero := int32(0)
+		scan := &scanv1alpha1.ClusterScan{
+			Spec: scanv1alpha1.ClusterScanSpec{FailurePolicy: &scanv1alpha1.FailurePolicy{MaxCritical: &zero}},
+			Status: scanv1alpha1.ClusterScanStatus{Targets: []scanv1alpha1.TargetStatus{
+				{Image: "nginx:1.25", Phase: PhasePolicyViolated,
+					Summary: &scanv1alpha1.VulnerabilitySummary{Critical: 1, High: 2, TopCVEs: []string{"CVE-1", "CVE-2"}}},
+				{Image: "redis:7", Phase: PhaseCompleted,
+					Summary: &scanv1alpha1.VulnerabilitySummary{High: 1, TopCVEs: []string{"CVE-2"}}},
+			}},
+		}
+
+		aggregateTargets(scan)
+		Expect(scan.Status.Summary.Critical).To(Equal(int32(1)))
+		Expect(scan.Status.Summary.High).To(Equal(int32(3)))
+		Expect(scan.Status.Summary.TopCVEs).To(Equal([]string{"CVE-1", "CVE-2"}))
+		Expect(scan.Status.Phase).To(Equal(PhasePolicyViolated))
+		Expect(policyViolated(scan)).To(BeTrue())
+
+		scan.Status.Targets[1].Phase = PhaseFailed
+		aggregateTargets(scan)
+		Expect(scan.Status.Phase).To(Equal(PhaseFailed))
+	})
+})
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// collectionGrace is the least time a finished Job is kept before its run is recorded. Jobs are
+// created with at least this TTL, so one finishing while the manager is busy or restarting is
+// not reaped before its logs are read; markCollected then sets the configured TTL.
+const collectionGrace int32 = 300
+
+// jobTTL returns how long finished scan Jobs are kept once recorded, or nil to keep them
+func (r *ClusterScanReconciler) jobTTL(clusterScan *scanv1alpha1.ClusterScan) *int32 {
+	if clusterScan.Spec.TTLSecondsAfterFinished != nil {
+		return clusterScan.Spec.TTLSecondsAfterFinished
+	}
+	return r.JobTTL
+}
+
+// applyJobTTL sets the TTL a scan Job or job template is created with
+func (r *ClusterScanReconciler) applyJobTTL(clusterScan *scanv1alpha1.ClusterScan, spec *batchv1.JobSpec) {
+	ttl := r.jobTTL(clusterScan)
+	if ttl == nil {
+		return
+	}
+	seconds := max(*ttl, collectionGrace)
+	spec.TTLSecondsAfterFinished = &seconds
+}
+
+// recordedRun reports whether a Job's run is already recorded, so a one-off scan whose Job is
+// gone reused a cached result or was reaped after its results were stored, rather than never
+// started. Runs trimmed from the history are still recognised as the last run.
+func recordedRun(clusterScan *scanv1alpha1.ClusterScan, jobName string) bool {
+	for _, run := range clusterScan.Status.History {
+		if run.JobName == jobName {
+			return true
+		}
+	}
+	if clusterScan.Status.LastJobName != jobName {
+		return false
+	}
+	switch clusterScan.Status.Phase {
+	case PhaseCompleted, PhasePolicyViolated, PhaseFailed, PhaseTimedOut:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Finished Job TTL", func() {
+	ctx := context.Background()
+	seconds := func(s int32) *int32 { return &s }
+	scan := func() *scanv1alpha1.ClusterScan {
+		return &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Generation: 1},
+			Spec:       scanv1alpha1.ClusterScanSpec{Image: "aquasec/trivy:0.50.0", Target: "nginx:1.25"},
+		}
+	}
+
+	It("should create Jobs and job templates with the TTL, leaving time to collect them", func() {
+		r := &ClusterScanReconciler{}
+		Expect(r.constructJob(scan(), "nginx-job").Spec.TTLSecondsAfterFinished).To(BeNil())
+
+		r.JobTTL = seconds(3600)
+		Expect(r.constructJob(scan(), "nginx-job").Spec.TTLSecondsAfterFinished).To(HaveValue(Equal(int32(3600))))
+
+		clusterScan := scan()
+		clusterScan.Spec.TTLSecondsAfterFinished = seconds(0)
+		Expect(r.jobTTL(clusterScan)).To(HaveValue(BeZero()))
+		Expect(r.constructJob(clusterScan, "nginx-job").Spec.TTLSecondsAfterFinished).To(HaveValue(Equal(collectionGrace)))
+	})
+
+	It("should set the TTL once results are stored and not rerun a reaped Job", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		clusterScan := scan()
+		clusterScan.Spec.TTLSecondsAfterFinished = seconds(0)
+		r := &ClusterScanReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(clusterScan).
+				WithStatusSubresource(&scanv1alpha1.ClusterScan{}, &batchv1.Job{}).Build(),
+			Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20), KubeClient: kubefake.NewSimpleClientset(),
+		}
+		key := client.ObjectKeyFromObject(clusterScan)
+		jobKey := client.ObjectKey{Name: "nginx-job", Namespace: "default"}
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, jobKey, job)).To(Succeed())
+		Expect(job.Spec.TTLSecondsAfterFinished).To(HaveValue(Equal(collectionGrace)))
+		job.Status.Succeeded = 1
+		Expect(r.Status().Update(ctx, job)).To(Succeed())
+		Expect(r.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx-job-abcde", Namespace: "default", Labels: map[string]string{"job-name": "nginx-job"}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name: ScannerContainer, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+			}}},
+		})).To(Succeed())
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, jobKey, job)).To(Succeed())
+		Expect(job.Labels).To(HaveKeyWithValue(CollectedLabel, "true"))
+		Expect(job.Spec.TTLSecondsAfterFinished).To(HaveValue(BeZero()))
+
+		// The TTL controller reaps the Job
+		Expect(r.Delete(ctx, job)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		jobs := &batchv1.JobList{}
+		Expect(r.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+		Expect(r.Get(ctx, key, clusterScan)).To(Succeed())
+		Expect(clusterScan.Status.Phase).To(Equal(PhaseCompleted))
+		Expect(clusterScan.Status.History).To(HaveLen(1))
+
+		// Edits that do not change what runs keep the result; others scan again
+		maxCritical := int32(0)
+		clusterScan.Spec.FailurePolicy = &scanv1alpha1.FailurePolicy{MaxCritical: &maxCritical}
+		clusterScan.Generation++
+		Expect(r.Update(ctx, clusterScan)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+
+		Expect(r.Get(ctx, key, clusterScan)).To(Succeed())
+		clusterScan.Spec.Target = "nginx:1.27"
+		clusterScan.Generation++
+		Expect(r.Update(ctx, clusterScan)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(ConsistOf(HaveField("Name", "nginx-job-g3")))
+	})
+})
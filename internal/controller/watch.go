@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// workloadKind returns the TargetSelector kind of a watched workload
+func workloadKind(obj client.Object) string {
+	switch obj.(type) {
+	case *corev1.Pod:
+		return scanv1alpha1.WorkloadPod
+	case *appsv1.Deployment:
+		return scanv1alpha1.WorkloadDeployment
+	case *appsv1.StatefulSet:
+		return scanv1alpha1.WorkloadStatefulSet
+	case *appsv1.DaemonSet:
+		return scanv1alpha1.WorkloadDaemonSet
+	default:
+		return ""
+	}
+}
+
+// workloadImages lists the images of a workload's containers and, for Pods, the digests they run
+func workloadImages(obj client.Object) []string {
+	var spec *corev1.PodSpec
+	var images []string
+	switch w := obj.(type) {
+	case *corev1.Pod:
+		spec = &w.Spec
+		for _, status := range append(w.Status.InitContainerStatuses, w.Status.ContainerStatuses...) {
+			images = append(images, status.ImageID)
+		}
+	case *appsv1.Deployment:
+		spec = &w.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		spec = &w.Spec.Template.Spec
+	case *appsv1.DaemonSet:
+		spec = &w.Spec.Template.Spec
+	default:
+		return nil
+	}
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+// workloadImagesChanged filters workload updates down to those that change an image or the digest
+// a Pod runs, so routine status updates don't trigger rediscovery
+var workloadImagesChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		before, after := workloadImages(e.ObjectOld), workloadImages(e.ObjectNew)
+		if len(before) != len(after) {
+			return true
+		}
+		for i := range before {
+			if before[i] != after[i] {
+				return true
+			}
+		}
+		// A Pod becoming Running is when its images are first discovered
+		if pod, ok := e.ObjectNew.(*corev1.Pod); ok {
+			return pod.Status.Phase != e.ObjectOld.(*corev1.Pod).Status.Phase
+		}
+		return false
+	},
+	GenericFunc: func(event.GenericEvent) bool { return false },
+}
+
+// requestsForWorkload maps a workload to every watching ClusterScan whose TargetSelector selects it
+func (r *ClusterScanReconciler) requestsForWorkload(ctx context.Context, obj client.Object) []reconcile.Request {
+	// Scanner pods are never scan targets
+	if obj.GetLabels()[ScanNameLabel] != "" {
+		return nil
+	}
+
+	scans := &scanv1alpha1.ClusterScanList{}
+	if err := r.List(ctx, scans); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Unable to list ClusterScans for workload", "workload", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, scan := range scans.Items {
+		if selectorWatches(scan.Spec.TargetSelector, workloadKind(obj), obj) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// selectorWatches reports whether a watching TargetSelector selects a workload of the given kind
+func selectorWatches(selector *scanv1alpha1.TargetSelector, kind string, obj client.Object) bool {
+	if selector == nil || !selector.Watch {
+		return false
+	}
+	if len(selector.Kinds) > 0 && !slices.Contains(selector.Kinds, kind) {
+		return false
+	}
+	if len(selector.Namespaces) > 0 && !slices.Contains(selector.Namespaces, obj.GetNamespace()) {
+		return false
+	}
+	if selector.LabelSelector != nil {
+		labelSelector, err := metav1.LabelSelectorAsSelector(selector.LabelSelector)
+		if err != nil || !labelSelector.Matches(labels.Set(obj.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
+
+// WorkloadCacheObjects trims the Pods and workloads the manager caches, which are watched
+// cluster-wide for TargetSelectors, down to what discovery and the watch predicates read:
+// labels, container names and images, and for Pods their phase and image IDs. Scan Pods are
+// kept whole, since their status explains failed runs.
+func WorkloadCacheObjects() map[client.Object]cache.ByObject {
+	return map[client.Object]cache.ByObject{
+		&corev1.Pod{}:         {Transform: trimWorkload},
+		&appsv1.Deployment{}:  {Transform: trimWorkload},
+		&appsv1.StatefulSet{}: {Transform: trimWorkload},
+		&appsv1.DaemonSet{}:   {Transform: trimWorkload},
+	}
+}
+
+// trimWorkload is the cache transform of WorkloadCacheObjects
+func trimWorkload(obj interface{}) (interface{}, error) {
+	w, ok := obj.(client.Object)
+	if !ok {
+		return obj, nil
+	}
+	w.SetManagedFields(nil)
+	if w.GetLabels()[ScanNameLabel] != "" {
+		return w, nil
+	}
+	w.SetAnnotations(nil)
+
+	switch w := w.(type) {
+	case *corev1.Pod:
+		w.Spec = trimPodSpec(&w.Spec)
+		status := corev1.PodStatus{Phase: w.Status.Phase}
+		for _, s := range w.Status.InitContainerStatuses {
+			status.InitContainerStatuses = append(status.InitContainerStatuses, corev1.ContainerStatus{Name: s.Name, ImageID: s.ImageID})
+		}
+		for _, s := range w.Status.ContainerStatuses {
+			status.ContainerStatuses = append(status.ContainerStatuses, corev1.ContainerStatus{Name: s.Name, ImageID: s.ImageID})
+		}
+		w.Status = status
+	case *appsv1.Deployment:
+		w.Spec = appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: trimPodSpec(&w.Spec.Template.Spec)}}
+		w.Status = appsv1.DeploymentStatus{}
+	case *appsv1.StatefulSet:
+		w.Spec = appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: trimPodSpec(&w.Spec.Template.Spec)}}
+		w.Status = appsv1.StatefulSetStatus{}
+	case *appsv1.DaemonSet:
+		w.Spec = appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{Spec: trimPodSpec(&w.Spec.Template.Spec)}}
+		w.Status = appsv1.DaemonSetStatus{}
+	}
+	return w, nil
+}
+
+// trimPodSpec keeps only the names and images of a Pod spec's containers
+func trimPodSpec(spec *corev1.PodSpec) corev1.PodSpec {
+	trimmed := corev1.PodSpec{}
+	for _, c := range spec.InitContainers {
+		trimmed.InitContainers = append(trimmed.InitContainers, corev1.Container{Name: c.Name, Image: c.Image})
+	}
+	for _, c := range spec.Containers {
+		trimmed.Containers = append(trimmed.Containers, corev1.Container{Name: c.Name, Image: c.Image})
+	}
+	return trimmed
+}
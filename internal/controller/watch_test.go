@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Workload watch", func() {
+	pod := func(name, image, imageID string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps", Labels: map[string]string{"tier": "web"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ImageID: imageID}},
+			},
+		}
+	}
+
+	It("should replace targets whose digest changed and drop finished targets that are gone", func() {
+		targets := []scanv1alpha1.TargetStatus{
+			{Image: "nginx:1.25", Digest: "sha256:old", Phase: PhaseCompleted, JobName: "scan-old"},
+			{Image: "redis:7", Phase: PhaseCompleted, JobName: "scan-redis"},
+			{Image: "busybox:1.36", Phase: PhaseCompleted},
+		}
+		merged, added, replaced := mergeTargets(targets, []discoveredImage{
+			{Image: "nginx:1.25", Digest: "sha256:new"},
+			{Image: "postgres:16"},
+			{Image: "redis:7", Digest: "sha256:abc"},
+		})
+
+		Expect(added).To(Equal([]string{"nginx:1.25@sha256:new", "postgres:16"}))
+		Expect(replaced).To(Equal([]string{"scan-old"}))
+		Expect(merged).To(Equal([]scanv1alpha1.TargetStatus{
+			{Image: "nginx:1.25", Digest: "sha256:new", Phase: PhasePending},
+			{Image: "postgres:16", Phase: PhasePending},
+			{Image: "redis:7", Digest: "sha256:abc", Phase: PhaseCompleted, JobName: "scan-redis"},
+		}))
+	})
+
+	It("should only map workloads selected by watching scans", func() {
+		selector := &scanv1alpha1.TargetSelector{
+			Namespaces:    []string{"apps"},
+			Kinds:         []string{scanv1alpha1.WorkloadPod},
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}},
+			Watch:         true,
+		}
+		Expect(selectorWatches(selector, scanv1alpha1.WorkloadPod, pod("web", "nginx:1.25", ""))).To(BeTrue())
+		Expect(selectorWatches(selector, scanv1alpha1.WorkloadDeployment, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Labels: map[string]string{"tier": "web"}},
+		})).To(BeFalse())
+
+		other := pod("db", "postgres:16", "")
+		other.Labels = map[string]string{"tier": "db"}
+		Expect(selectorWatches(selector, scanv1alpha1.WorkloadPod, other)).To(BeFalse())
+
+		selector.Watch = false
+		Expect(selectorWatches(selector, scanv1alpha1.WorkloadPod, pod("web", "nginx:1.25", ""))).To(BeFalse())
+	})
+
+	It("should ignore updates that do not change images", func() {
+		before := pod("web", "nginx:1.25", "docker.io/library/nginx@sha256:old")
+		after := before.DeepCopy()
+		after.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		Expect(workloadImagesChanged.Update(event.UpdateEvent{ObjectOld: before, ObjectNew: after})).To(BeFalse())
+
+		after.Status.ContainerStatuses[0].ImageID = "docker.io/library/nginx@sha256:new"
+		Expect(workloadImagesChanged.Update(event.UpdateEvent{ObjectOld: before, ObjectNew: after})).To(BeTrue())
+	})
+
+	It("should cache only the fields discovery and the watch read", func() {
+		full := pod("web", "nginx:1.25", "docker.io/library/nginx@sha256:abc")
+		full.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"}
+		full.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "MODE", Value: "prod"}}
+		full.Spec.Volumes = []corev1.Volume{{Name: "data"}}
+		full.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+
+		trimmed, err := trimWorkload(full.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trimmed).To(Equal(pod("web", "nginx:1.25", "docker.io/library/nginx@sha256:abc")))
+		Expect(workloadImages(trimmed.(*corev1.Pod))).To(Equal(workloadImages(full)))
+
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps", Labels: map[string]string{"tier": "web"}},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"tier": "web"}},
+				Spec:       full.Spec,
+			}},
+			Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+		}
+		trimmed, err = trimWorkload(deployment.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trimmed.(*appsv1.Deployment).Labels).To(Equal(deployment.Labels))
+		Expect(trimmed.(*appsv1.Deployment).Spec.Template.Spec).To(Equal(corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "nginx:1.25"}},
+		}))
+		Expect(trimmed.(*appsv1.Deployment).Status).To(Equal(appsv1.DeploymentStatus{}))
+
+		// Scan Pods keep their status for diagnostics
+		scanPod := full.DeepCopy()
+		scanPod.Labels = map[string]string{ScanNameLabel: "nginx"}
+		trimmed, err = trimWorkload(scanPod.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trimmed).To(Equal(scanPod))
+	})
+
+	It("should scan a new digest when a watched workload changes", func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		scan := &scanv1alpha1.ClusterScan{
+			ObjectMeta: metav1.ObjectMeta{Name: "watched", Namespace: "default"},
+			Spec: scanv1alpha1.ClusterScanSpec{
+				Image:          "aquasec/trivy:0.50.0",
+				TargetSelector: &scanv1alpha1.TargetSelector{Namespaces: []string{"apps"}, Watch: true},
+			},
+		}
+		web := pod("web", "nginx:1.25", "docker.io/library/nginx@sha256:old")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(scan, web).WithStatusSubresource(&scanv1alpha1.ClusterScan{}).Build()
+		r := &ClusterScanReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(20)}
+		ctx := context.Background()
+
+		_, err := r.reconcileTargets(ctx, scan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scan.Status.Targets).To(HaveLen(1))
+		firstJob := scan.Status.Targets[0].JobName
+
+		web.Status.ContainerStatuses[0].ImageID = "docker.io/library/nginx@sha256:new"
+		Expect(c.Status().Update(ctx, web)).To(Succeed())
+		_, err = r.reconcileTargets(ctx, scan)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(scan.Status.Targets).To(HaveLen(1))
+		Expect(scan.Status.Targets[0].Digest).To(Equal("sha256:new"))
+		Expect(scan.Status.Targets[0].JobName).NotTo(Equal(firstJob))
+
+		jobs := &batchv1.JobList{}
+		Expect(c.List(ctx, jobs, client.InNamespace("default"))).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		Expect(jobs.Items[0].Name).To(Equal(scan.Status.Targets[0].JobName))
+	})
+})
@@ -0,0 +1,281 @@
+package resultstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// Keys used in result ConfigMaps. Output that fits is stored as text under OutputKey,
+// larger output is gzip-compressed under CompressedOutputKey, and output that is still
+// too large is split across numbered chunk ConfigMaps listed under ManifestKey.
+const (
+	OutputKey           = "scan-output.txt"
+	CompressedOutputKey = "scan-output.txt.gz"
+	ManifestKey         = "manifest.json"
+	ChunkKey            = "chunk"
+)
+
+// maxConfigMapOutput keeps the output, metadata keys and object metadata under the
+// 1MiB limit the API server enforces on ConfigMaps
+const maxConfigMapOutput = 1000 * 1024
+
+// maxChunks bounds how many chunk ConfigMaps a single output may be split into
+const maxChunks = 64
+
+// chunkManifest describes output split across several ConfigMaps
+type chunkManifest struct {
+	// Encoding of the concatenated chunks; always gzip
+	Encoding string `json:"encoding"`
+
+	// Chunks lists the chunk ConfigMaps in order
+	Chunks []string `json:"chunks"`
+
+	// Size and Checksum describe the uncompressed output
+	Size     int    `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+type configMapStore struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// NewConfigMapStore returns a Store that keeps output in ConfigMaps next to the ClusterScan
+func NewConfigMapStore(c client.Client, scheme *runtime.Scheme) Store {
+	return &configMapStore{client: c, scheme: scheme}
+}
+
+func (s *configMapStore) Put(ctx context.Context, obj Object, data []byte) (*scanv1alpha1.StoredResult, error) {
+	configMap, err := s.newConfigMap(obj, obj.Name)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range obj.Metadata {
+		configMap.Data[key] = value
+	}
+
+	if len(data) <= maxConfigMapOutput {
+		configMap.Data[OutputKey] = string(data)
+	} else {
+		compressed, err := compress(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) <= maxConfigMapOutput {
+			configMap.BinaryData = map[string][]byte{CompressedOutputKey: compressed}
+		} else {
+			manifest, err := s.putChunks(ctx, obj, compressed)
+			if err != nil {
+				return nil, err
+			}
+			manifest.Size = len(data)
+			manifest.Checksum = Checksum(data)
+			encoded, err := json.Marshal(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode chunk manifest: %v", err)
+			}
+			configMap.Data[ManifestKey] = string(encoded)
+		}
+	}
+
+	if err := s.apply(ctx, configMap); err != nil {
+		return nil, err
+	}
+	return storedResult(configMapURI(obj.Namespace, obj.Name), data), nil
+}
+
+// putChunks splits compressed output across ConfigMaps named <name>-1, <name>-2, ...
+func (s *configMapStore) putChunks(ctx context.Context, obj Object, compressed []byte) (*chunkManifest, error) {
+	count := (len(compressed) + maxConfigMapOutput - 1) / maxConfigMapOutput
+	if count > maxChunks {
+		return nil, fmt.Errorf("%w: %d compressed bytes need more than %d ConfigMaps", ErrTooLarge, len(compressed), maxChunks)
+	}
+
+	manifest := &chunkManifest{Encoding: "gzip"}
+	for i := 0; i < count; i++ {
+		end := min((i+1)*maxConfigMapOutput, len(compressed))
+		chunk, err := s.newConfigMap(obj, fmt.Sprintf("%s-%d", obj.Name, i+1))
+		if err != nil {
+			return nil, err
+		}
+		chunk.BinaryData = map[string][]byte{ChunkKey: compressed[i*maxConfigMapOutput : end]}
+		if err := s.apply(ctx, chunk); err != nil {
+			return nil, err
+		}
+		manifest.Chunks = append(manifest.Chunks, chunk.Name)
+	}
+	return manifest, nil
+}
+
+func (s *configMapStore) newConfigMap(obj Object, name string) (*corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: obj.Namespace,
+			Labels:    obj.Labels,
+		},
+		Data: map[string]string{},
+	}
+	if obj.Owner != nil {
+		if err := controllerutil.SetControllerReference(obj.Owner, configMap, s.scheme); err != nil {
+			return nil, fmt.Errorf("failed to set owner reference: %v", err)
+		}
+	}
+	return configMap, nil
+}
+
+// apply creates the ConfigMap or replaces the contents of an existing one
+func (s *configMapStore) apply(ctx context.Context, configMap *corev1.ConfigMap) error {
+	existing := &corev1.ConfigMap{}
+	err := s.client.Get(ctx, client.ObjectKeyFromObject(configMap), existing)
+	if err != nil && errors.IsNotFound(err) {
+		if err := s.client.Create(ctx, configMap); err != nil {
+			return fmt.Errorf("failed to create ConfigMap %s: %v", configMap.Name, err)
+		}
+	} else if err == nil {
+		existing.Data = configMap.Data
+		existing.BinaryData = configMap.BinaryData
+		if err := s.client.Update(ctx, existing); err != nil {
+			return fmt.Errorf("failed to update ConfigMap %s: %v", configMap.Name, err)
+		}
+	} else {
+		return fmt.Errorf("error checking ConfigMap %s: %v", configMap.Name, err)
+	}
+	return nil
+}
+
+func (s *configMapStore) Get(ctx context.Context, uri string) ([]byte, error) {
+	key, err := parseConfigMapURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := s.client.Get(ctx, key, configMap); err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s: %v", key, err)
+	}
+
+	if output, ok := configMap.Data[OutputKey]; ok {
+		return []byte(output), nil
+	}
+	if compressed, ok := configMap.BinaryData[CompressedOutputKey]; ok {
+		return decompress(compressed)
+	}
+	if _, ok := configMap.Data[ManifestKey]; ok {
+		return s.getChunks(ctx, configMap)
+	}
+	return nil, fmt.Errorf("ConfigMap %s holds no scan output", key)
+}
+
+// getChunks reassembles output split across chunk ConfigMaps and verifies its checksum
+func (s *configMapStore) getChunks(ctx context.Context, configMap *corev1.ConfigMap) ([]byte, error) {
+	manifest := &chunkManifest{}
+	if err := json.Unmarshal([]byte(configMap.Data[ManifestKey]), manifest); err != nil {
+		return nil, fmt.Errorf("invalid chunk manifest in ConfigMap %s: %v", configMap.Name, err)
+	}
+
+	var compressed bytes.Buffer
+	for _, name := range manifest.Chunks {
+		chunk := &corev1.ConfigMap{}
+		if err := s.client.Get(ctx, types.NamespacedName{Name: name, Namespace: configMap.Namespace}, chunk); err != nil {
+			return nil, fmt.Errorf("failed to get chunk ConfigMap %s: %v", name, err)
+		}
+		compressed.Write(chunk.BinaryData[ChunkKey])
+	}
+
+	data, err := decompress(compressed.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if Checksum(data) != manifest.Checksum {
+		return nil, fmt.Errorf("checksum mismatch reassembling ConfigMap %s", configMap.Name)
+	}
+	return data, nil
+}
+
+func (s *configMapStore) Delete(ctx context.Context, uri string) error {
+	key, err := parseConfigMapURI(uri)
+	if err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := s.client.Get(ctx, key, configMap); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get ConfigMap %s: %v", key, err)
+	}
+
+	if encoded, ok := configMap.Data[ManifestKey]; ok {
+		manifest := &chunkManifest{}
+		if err := json.Unmarshal([]byte(encoded), manifest); err == nil {
+			for _, name := range manifest.Chunks {
+				chunk := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: key.Namespace}}
+				if err := s.client.Delete(ctx, chunk); client.IgnoreNotFound(err) != nil {
+					return fmt.Errorf("failed to delete chunk ConfigMap %s: %v", name, err)
+				}
+			}
+		}
+	}
+
+	if err := s.client.Delete(ctx, configMap); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete ConfigMap %s: %v", key, err)
+	}
+	return nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress output: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress output: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(compressed []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress output: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress output: %v", err)
+	}
+	return data, nil
+}
+
+func configMapURI(namespace, name string) string {
+	return fmt.Sprintf("%s://%s/%s", TypeConfigMap, namespace, name)
+}
+
+func parseConfigMapURI(uri string) (types.NamespacedName, error) {
+	path, err := trimScheme(uri, TypeConfigMap)
+	if err != nil {
+		return types.NamespacedName{}, err
+	}
+	namespace, name, ok := strings.Cut(path, "/")
+	if !ok || namespace == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("malformed ConfigMap result URI %q", uri)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
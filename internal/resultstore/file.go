@@ -0,0 +1,95 @@
+package resultstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+type fileStore struct {
+	root string
+}
+
+// NewFileStore returns a Store that writes output under root, which is expected to be
+// a PersistentVolume mounted into the manager pod
+func NewFileStore(root string) (Store, error) {
+	if root == "" {
+		return nil, fmt.Errorf("a result store path is required for the %s store", TypePVC)
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result store path: %v", err)
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create result store directory: %v", err)
+	}
+	return &fileStore{root: root}, nil
+}
+
+func (s *fileStore) Put(_ context.Context, obj Object, data []byte) (*scanv1alpha1.StoredResult, error) {
+	path := filepath.Join(s.root, obj.Namespace, obj.Name+".txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create result directory: %v", err)
+	}
+
+	// Write to a temporary file first so readers never see partial output
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+obj.Name+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create result file: %v", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return nil, fmt.Errorf("failed to write result file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write result file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to write result file: %v", err)
+	}
+
+	return storedResult("file://"+path, data), nil
+}
+
+func (s *fileStore) Get(_ context.Context, uri string) ([]byte, error) {
+	path, err := s.pathFor(uri)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result file: %v", err)
+	}
+	return data, nil
+}
+
+func (s *fileStore) Delete(_ context.Context, uri string) error {
+	path, err := s.pathFor(uri)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete result file: %v", err)
+	}
+	return nil
+}
+
+// pathFor resolves a file:// URI, refusing paths outside the store's root
+func (s *fileStore) pathFor(uri string) (string, error) {
+	path, err := trimScheme(uri, "file")
+	if err != nil {
+		return "", err
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("result URI %q is outside %s", uri, s.root)
+	}
+	return path, nil
+}
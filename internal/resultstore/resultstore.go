@@ -0,0 +1,107 @@
+// Package resultstore keeps raw scanner output outside of the ScanReport, which only
+// holds normalized findings. Output can be stored in ConfigMaps, in files on a
+// PersistentVolume mounted into the manager, or in an S3-compatible bucket.
+package resultstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// Supported store types, selected with the manager's --result-store flag
+const (
+	TypeConfigMap = "configmap"
+	TypePVC       = "pvc"
+	TypeS3        = "s3"
+)
+
+// ErrTooLarge is returned when output exceeds what a store can hold
+var ErrTooLarge = errors.New("output exceeds the result store size limit")
+
+// IsTooLarge reports whether err was caused by output exceeding the store's size limit
+func IsTooLarge(err error) bool {
+	return errors.Is(err, ErrTooLarge)
+}
+
+// Object describes a piece of raw output to store
+type Object struct {
+	Namespace string
+	Name      string
+
+	// Labels are applied to stored objects that support them (ConfigMaps)
+	Labels map[string]string
+
+	// Metadata is stored alongside the output where the backend allows it
+	Metadata map[string]string
+
+	// Owner, if set, becomes the controller owner of stored Kubernetes objects
+	// so they are garbage collected with it
+	Owner client.Object
+}
+
+// Store persists raw scanner output and addresses it by URI
+type Store interface {
+	// Put stores data and returns its location and checksum
+	Put(ctx context.Context, obj Object, data []byte) (*scanv1alpha1.StoredResult, error)
+
+	// Get returns the data stored at uri
+	Get(ctx context.Context, uri string) ([]byte, error)
+
+	// Delete removes the data stored at uri. Deleting missing data is not an error.
+	Delete(ctx context.Context, uri string) error
+}
+
+// Config selects and configures a Store
+type Config struct {
+	// Type is one of TypeConfigMap, TypePVC or TypeS3
+	Type string
+
+	// Path is the directory results are written to when Type is TypePVC
+	Path string
+
+	// S3 configures the bucket used when Type is TypeS3
+	S3 S3Config
+}
+
+// New returns the Store described by cfg
+func New(cfg Config, c client.Client, scheme *runtime.Scheme) (Store, error) {
+	switch cfg.Type {
+	case "", TypeConfigMap:
+		return NewConfigMapStore(c, scheme), nil
+	case TypePVC:
+		return NewFileStore(cfg.Path)
+	case TypeS3:
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown result store type %q (expected %s, %s or %s)",
+			cfg.Type, TypeConfigMap, TypePVC, TypeS3)
+	}
+}
+
+// Checksum returns the SHA-256 digest of data in the form sha256:<hex>
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func storedResult(uri string, data []byte) *scanv1alpha1.StoredResult {
+	return &scanv1alpha1.StoredResult{URI: uri, Checksum: Checksum(data), Size: int64(len(data))}
+}
+
+// trimScheme returns the part of uri after scheme://
+func trimScheme(uri, scheme string) (string, error) {
+	prefix := scheme + "://"
+	if !strings.HasPrefix(uri, prefix) {
+		return "", fmt.Errorf("unsupported result URI %q for %s store", uri, scheme)
+	}
+	return strings.TrimPrefix(uri, prefix), nil
+}
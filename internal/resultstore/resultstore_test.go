@@ -0,0 +1,159 @@
+package resultstore
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Result stores", func() {
+	ctx := context.Background()
+	output := []byte(`{"SchemaVersion": 2}`)
+
+	Context("ConfigMap", func() {
+		It("should store output with metadata and address it by URI", func() {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			store := NewConfigMapStore(c, scheme.Scheme)
+
+			stored, err := store.Put(ctx, Object{
+				Namespace: "default", Name: "scan-job-results",
+				Labels:   map[string]string{"app": "clusterscan"},
+				Metadata: map[string]string{"target": "nginx:1.19"},
+			}, output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.URI).To(Equal("configmap://default/scan-job-results"))
+			Expect(stored.Checksum).To(Equal(Checksum(output)))
+			Expect(stored.Size).To(Equal(int64(len(output))))
+
+			configMap := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "scan-job-results", Namespace: "default"}, configMap)).To(Succeed())
+			Expect(configMap.Labels).To(HaveKeyWithValue("app", "clusterscan"))
+			Expect(configMap.Data).To(HaveKeyWithValue("target", "nginx:1.19"))
+
+			data, err := store.Get(ctx, stored.URI)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(output))
+
+			Expect(store.Delete(ctx, stored.URI)).To(Succeed())
+			Expect(store.Delete(ctx, stored.URI)).To(Succeed())
+		})
+
+		It("should compress output larger than a ConfigMap can hold", func() {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			store := NewConfigMapStore(c, scheme.Scheme)
+			large := []byte(strings.Repeat(`{"VulnerabilityID": "CVE-2021-0001"}`, 60000))
+
+			stored, err := store.Put(ctx, Object{Namespace: "default", Name: "compressed"}, large)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Checksum).To(Equal(Checksum(large)))
+
+			configMap := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "compressed", Namespace: "default"}, configMap)).To(Succeed())
+			Expect(configMap.Data).NotTo(HaveKey(OutputKey))
+			Expect(configMap.BinaryData).To(HaveKey(CompressedOutputKey))
+
+			data, err := store.Get(ctx, stored.URI)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(large))
+		})
+
+		It("should split incompressible output across numbered ConfigMaps", func() {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			store := NewConfigMapStore(c, scheme.Scheme)
+			large := make([]byte, 3<<20)
+			_, _ = rand.New(rand.NewSource(1)).Read(large)
+
+			stored, err := store.Put(ctx, Object{Namespace: "default", Name: "chunked"}, large)
+			Expect(err).NotTo(HaveOccurred())
+
+			configMap := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "chunked", Namespace: "default"}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKey(ManifestKey))
+			for _, name := range []string{"chunked-1", "chunked-2", "chunked-3", "chunked-4"} {
+				Expect(c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, &corev1.ConfigMap{})).To(Succeed())
+			}
+
+			data, err := store.Get(ctx, stored.URI)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Checksum(data)).To(Equal(stored.Checksum))
+
+			Expect(store.Delete(ctx, stored.URI)).To(Succeed())
+			configMaps := &corev1.ConfigMapList{}
+			Expect(c.List(ctx, configMaps)).To(Succeed())
+			Expect(configMaps.Items).To(BeEmpty())
+		})
+
+		It("should set the owner reference", func() {
+			owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "default", UID: "1234"}}
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			store := NewConfigMapStore(c, scheme.Scheme)
+
+			_, err := store.Put(ctx, Object{Namespace: "default", Name: "owned", Owner: owner}, output)
+			Expect(err).NotTo(HaveOccurred())
+			configMap := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "owned", Namespace: "default"}, configMap)).To(Succeed())
+			Expect(configMap.OwnerReferences).To(HaveLen(1))
+			Expect(configMap.OwnerReferences[0].Name).To(Equal("owner"))
+		})
+	})
+
+	Context("PVC", func() {
+		It("should write output under the namespace directory", func() {
+			root := GinkgoT().TempDir()
+			store, err := NewFileStore(root)
+			Expect(err).NotTo(HaveOccurred())
+
+			stored, err := store.Put(ctx, Object{Namespace: "default", Name: "scan-job-results"}, output)
+			Expect(err).NotTo(HaveOccurred())
+			path := filepath.Join(root, "default", "scan-job-results.txt")
+			Expect(stored.URI).To(Equal("file://" + path))
+			Expect(os.ReadFile(path)).To(Equal(output))
+
+			data, err := store.Get(ctx, stored.URI)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(output))
+
+			Expect(store.Delete(ctx, stored.URI)).To(Succeed())
+			Expect(path).NotTo(BeAnExistingFile())
+		})
+
+		It("should refuse URIs outside its root", func() {
+			store, err := NewFileStore(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.Get(ctx, "file:///etc/passwd")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("S3", func() {
+		It("should require an endpoint and bucket", func() {
+			_, err := NewS3Store(S3Config{Endpoint: "minio:9000"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should parse object URIs", func() {
+			bucket, key, err := parseS3URI("s3://scans/prod/default/scan-job-results.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bucket).To(Equal("scans"))
+			Expect(key).To(Equal("prod/default/scan-job-results.txt"))
+
+			_, _, err = parseS3URI("configmap://default/scan-job-results")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("should reject unknown store types", func() {
+		_, err := New(Config{Type: "nfs"}, nil, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
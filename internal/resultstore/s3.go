@@ -0,0 +1,122 @@
+package resultstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// S3Config configures an S3-compatible bucket such as AWS S3 or MinIO. Credentials are
+// read from AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY or MINIO_ROOT_USER/MINIO_ROOT_PASSWORD.
+type S3Config struct {
+	// Endpoint is the host[:port] of the S3 API, e.g. s3.amazonaws.com or minio.minio:9000
+	Endpoint string
+
+	Bucket string
+
+	// Prefix is prepended to every object key
+	Prefix string
+
+	Region string
+
+	// Insecure uses plain HTTP, for in-cluster MinIO without TLS
+	Insecure bool
+}
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Store returns a Store that uploads output to an S3-compatible bucket
+func NewS3Store(cfg S3Config) (Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("an endpoint and bucket are required for the %s store", TypeS3)
+	}
+	c, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+		}),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %v", err)
+	}
+	return &s3Store{client: c, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, obj Object, data []byte) (*scanv1alpha1.StoredResult, error) {
+	key := s.objectKey(obj)
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  "text/plain",
+		UserMetadata: obj.Metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	return storedResult(s3URI(s.bucket, key), data), nil
+}
+
+func (s *s3Store) Get(ctx context.Context, uri string) ([]byte, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", uri, err)
+	}
+	defer func() { _ = object.Close() }()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", uri, err)
+	}
+	return data, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, uri string) error {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil
+		}
+		return fmt.Errorf("failed to delete %s: %v", uri, err)
+	}
+	return nil
+}
+
+// objectKey lays objects out as <prefix><namespace>/<name>.txt
+func (s *s3Store) objectKey(obj Object) string {
+	return s.prefix + path.Join(obj.Namespace, obj.Name+".txt")
+}
+
+func s3URI(bucket, key string) string {
+	return fmt.Sprintf("%s://%s/%s", TypeS3, bucket, key)
+}
+
+func parseS3URI(uri string) (bucket, key string, err error) {
+	rest, err := trimScheme(uri, TypeS3)
+	if err != nil {
+		return "", "", err
+	}
+	bucket, key, ok := strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("malformed S3 result URI %q", uri)
+	}
+	return bucket, key, nil
+}
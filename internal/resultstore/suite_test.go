@@ -0,0 +1,13 @@
+package resultstore
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestResultStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Result Store Suite")
+}
@@ -0,0 +1,88 @@
+// Package scanner identifies the security scanner families supported by the operator.
+package scanner
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Known scanner types, detected from the scanner container image.
+const (
+	Trivy     = "trivy"
+	Grype     = "grype"
+	KubeBench = "kube-bench"
+	Kubesec   = "kubesec"
+	Unknown   = "unknown"
+)
+
+// Known lists the scanner types the operator recognizes.
+var Known = []string{Trivy, Grype, KubeBench, Kubesec}
+
+// DetectType infers the scanner type from an image reference such as aquasec/trivy:0.48.0.
+func DetectType(image string) string {
+	image = strings.ToLower(image)
+	switch {
+	case strings.Contains(image, Trivy):
+		return Trivy
+	case strings.Contains(image, KubeBench):
+		return KubeBench
+	case strings.Contains(image, Grype):
+		return Grype
+	case strings.Contains(image, Kubesec):
+		return Kubesec
+	default:
+		return Unknown
+	}
+}
+
+// FindingsExitCode returns the exit code a scanner run with command uses to report findings.
+// Trivy and kube-bench take it from their --exit-code flag, and Grype exits 1 when run with
+// --fail-on (-f). Runs without these flags, and other scanners, exit 0 whatever they find, so
+// ok is false.
+func FindingsExitCode(scannerType string, command []string) (code int32, ok bool) {
+	switch scannerType {
+	case Trivy, KubeBench:
+		return exitCodeFlag(command)
+	case Grype:
+		if failOnFlag(command) {
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// exitCodeFlag returns the value of a non-zero --exit-code flag in command
+func exitCodeFlag(command []string) (code int32, ok bool) {
+	for i, arg := range command {
+		var value string
+		switch {
+		case strings.HasPrefix(arg, "--exit-code="):
+			value = strings.TrimPrefix(arg, "--exit-code=")
+		case arg == "--exit-code" && i+1 < len(command):
+			value = command[i+1]
+		default:
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || parsed == 0 {
+			return 0, false
+		}
+		return int32(parsed), true
+	}
+	return 0, false
+}
+
+// failOnFlag reports whether command sets Grype's --fail-on (-f) severity threshold
+func failOnFlag(command []string) bool {
+	for i, arg := range command {
+		for _, flag := range []string{"--fail-on", "-f"} {
+			if arg == flag && i+1 < len(command) && command[i+1] != "" {
+				return true
+			}
+			if value, found := strings.CutPrefix(arg, flag+"="); found && value != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,10 +2,14 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/robfig/cron/v3"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -13,6 +17,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	"github.com/ahmali3/clusterscan-operator/internal/scanner"
 )
 
 const (
@@ -50,9 +55,25 @@ func (w *ClusterScanWebhook) Default(ctx context.Context, obj runtime.Object) er
 		clusterscanlog.Info("Defaulted image to trivy", "image", clusterscan.Spec.Image)
 	}
 
-	if len(clusterscan.Spec.Command) == 0 && clusterscan.Spec.Target != "" && strings.Contains(clusterscan.Spec.Image, "trivy") {
-		clusterscan.Spec.Command = []string{"trivy", "image", clusterscan.Spec.Target}
-		clusterscanlog.Info("Defaulted Trivy command", "command", clusterscan.Spec.Command, "target", clusterscan.Spec.Target)
+	if len(clusterscan.Spec.Command) == 0 && clusterscan.Spec.TargetSelector != nil && scanner.DetectType(clusterscan.Spec.Image) == scanner.Trivy {
+		clusterscan.Spec.Command = []string{"trivy", "image", "--format", "json", "$(SCAN_TARGET)"}
+		clusterscanlog.Info("Defaulted Trivy command for target selector", "command", clusterscan.Spec.Command)
+	}
+
+	// Target scans are left without a command; the controller builds it from the current target,
+	// so editing the target scans the new image. Earlier versions defaulted the command from the
+	// target, which pinned the old image, so such a command is dropped when the target changes.
+	if old := oldClusterScan(ctx); old != nil && old.Spec.Target != "" && old.Spec.Target != clusterscan.Spec.Target &&
+		equalCommands(clusterscan.Spec.Command, []string{"trivy", "image", "--format", "json", old.Spec.Target}) {
+		clusterscan.Spec.Command = nil
+		clusterscanlog.Info("Dropped Trivy command defaulted from the previous target", "target", clusterscan.Spec.Target)
+	}
+
+	// kube-bench detects which node components it runs next to, so one command fits every node
+	if len(clusterscan.Spec.Command) == 0 && clusterscan.Spec.HostAccess != nil &&
+		scanner.DetectType(clusterscan.Spec.Image) == scanner.KubeBench {
+		clusterscan.Spec.Command = []string{"kube-bench", "run", "--json"}
+		clusterscanlog.Info("Defaulted kube-bench command for host access", "command", clusterscan.Spec.Command)
 	}
 
 	return nil
@@ -113,8 +134,23 @@ func (w *ClusterScanWebhook) validateClusterScan(r *scanv1alpha1.ClusterScan) (a
 		warnings = append(warnings, "Image has no tag specified - will use 'latest' by default")
 	}
 
-	if r.Spec.Target == "" && len(r.Spec.Command) == 0 {
-		return nil, fmt.Errorf("either 'target' or 'command' must be specified")
+	if r.Spec.Target == "" && r.Spec.TargetSelector == nil && len(r.Spec.Command) == 0 {
+		return nil, fmt.Errorf("either 'target' or 'command' must be specified, unless 'targetSelector' is set")
+	}
+
+	if r.Spec.TargetSelector != nil {
+		if r.Spec.Target != "" {
+			return nil, fmt.Errorf("'target' and 'targetSelector' are mutually exclusive")
+		}
+		if r.Spec.Schedule != "" {
+			return nil, fmt.Errorf("'targetSelector' is not supported with 'schedule' yet")
+		}
+		if len(r.Spec.Command) > 0 && !strings.Contains(strings.Join(r.Spec.Command, " "), "$(SCAN_TARGET)") {
+			warnings = append(warnings, "'command' does not reference $(SCAN_TARGET) - every Job will scan the same thing")
+		}
+		if len(r.Spec.TargetSelector.Namespaces) == 0 {
+			warnings = append(warnings, "'targetSelector' has no namespaces - images are discovered cluster-wide")
+		}
 	}
 
 	if r.Spec.Target != "" && len(r.Spec.Command) > 0 {
@@ -150,6 +186,106 @@ func (w *ClusterScanWebhook) validateClusterScan(r *scanv1alpha1.ClusterScan) (a
 		}
 	}
 
+	if r.Spec.Timeout != nil && r.Spec.Timeout.Duration < time.Second {
+		return nil, fmt.Errorf("'timeout' must be at least 1s, got %s", r.Spec.Timeout.Duration)
+	}
+
+	codes := map[int32]bool{}
+	for _, rule := range r.Spec.ExitCodes {
+		if codes[rule.Code] {
+			return nil, fmt.Errorf("exit code %d is listed more than once in 'exitCodes'", rule.Code)
+		}
+		codes[rule.Code] = true
+	}
+
+	volumes := map[string]bool{}
+	for _, volume := range r.Spec.Volumes {
+		volumes[volume.Name] = true
+	}
+	for _, mount := range r.Spec.VolumeMounts {
+		if !volumes[mount.Name] {
+			return nil, fmt.Errorf("volumeMount '%s' does not match any entry in 'volumes'", mount.Name)
+		}
+	}
+
+	if access := r.Spec.HostAccess; access != nil {
+		if scanner.DetectType(r.Spec.Image) != scanner.KubeBench {
+			return nil, fmt.Errorf("'hostAccess' is only supported for kube-bench scanner images")
+		}
+		for _, name := range []string{"etc-kubernetes", "var-lib-kubelet", "etc-systemd"} {
+			if volumes[name] {
+				return nil, fmt.Errorf("volume name '%s' is reserved for 'hostAccess'", name)
+			}
+		}
+		if access.AllNodes {
+			if access.NodeName != "" {
+				return nil, fmt.Errorf("'hostAccess.nodeName' and 'hostAccess.allNodes' are mutually exclusive")
+			}
+			if r.Spec.TargetSelector != nil {
+				return nil, fmt.Errorf("'hostAccess.allNodes' cannot be combined with 'targetSelector'")
+			}
+			if r.Spec.Schedule != "" {
+				return nil, fmt.Errorf("'hostAccess.allNodes' is not supported with 'schedule' yet")
+			}
+		}
+	}
+
+	if perNode := r.Spec.PerNode; perNode != nil {
+		if r.Spec.TargetSelector != nil {
+			return nil, fmt.Errorf("'perNode' cannot be combined with 'targetSelector'")
+		}
+		if r.Spec.Schedule != "" {
+			return nil, fmt.Errorf("'perNode' is not supported with 'schedule' yet")
+		}
+		if r.Spec.HostAccess != nil && r.Spec.HostAccess.NodeName != "" {
+			return nil, fmt.Errorf("'perNode' and 'hostAccess.nodeName' are mutually exclusive")
+		}
+		if perNode.NodeSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(perNode.NodeSelector); err != nil {
+				return nil, fmt.Errorf("invalid 'perNode.nodeSelector': %v", err)
+			}
+		}
+		if r.Spec.HostAccess == nil && scanner.DetectType(r.Spec.Image) == scanner.KubeBench {
+			warnings = append(warnings, "kube-bench runs without 'hostAccess' - it cannot inspect the nodes")
+		}
+	}
+
+	if r.Spec.TargetCredentials != nil {
+		if volumes["target-credentials"] {
+			return nil, fmt.Errorf("volume name 'target-credentials' is reserved for 'targetCredentials'")
+		}
+		if scannerType := scanner.DetectType(r.Spec.Image); scannerType == scanner.KubeBench || scannerType == scanner.Kubesec {
+			warnings = append(warnings, fmt.Sprintf("'targetCredentials' has no effect on %s, which does not pull images", scannerType))
+		}
+	}
+
+	containers := map[string]bool{"scanner": true}
+	for _, sidecar := range r.Spec.Sidecars {
+		if containers[sidecar.Name] {
+			return nil, fmt.Errorf("sidecar name '%s' is already used by another container", sidecar.Name)
+		}
+		containers[sidecar.Name] = true
+		for _, mount := range sidecar.VolumeMounts {
+			if !volumes[mount.Name] {
+				return nil, fmt.Errorf("volumeMount '%s' of sidecar '%s' does not match any entry in 'volumes'", mount.Name, sidecar.Name)
+			}
+		}
+	}
+	if len(r.Spec.Sidecars) > 0 && volumes["scan-results"] {
+		return nil, fmt.Errorf("volume name 'scan-results' is reserved for the volume shared with 'sidecars'")
+	}
+	if r.Spec.ResultsContainer != "" && !containers[r.Spec.ResultsContainer] {
+		return nil, fmt.Errorf("'resultsContainer' must be 'scanner' or the name of a sidecar, got '%s'", r.Spec.ResultsContainer)
+	}
+
+	if r.Spec.TargetSelector != nil {
+		for _, env := range r.Spec.Env {
+			if env.Name == "SCAN_TARGET" {
+				return nil, fmt.Errorf("'env' cannot set SCAN_TARGET, which selector scans set to the discovered image")
+			}
+		}
+	}
+
 	if strings.HasSuffix(r.Spec.Image, ":latest") {
 		warnings = append(warnings, "Using ':latest' tag for scanner image is not recommended for production")
 	}
@@ -158,15 +294,7 @@ func (w *ClusterScanWebhook) validateClusterScan(r *scanv1alpha1.ClusterScan) (a
 		warnings = append(warnings, "Scanning ':latest' tag - consider pinning to specific version for reproducibility")
 	}
 
-	knownScanners := []string{"trivy", "grype", "kube-bench", "kubesec"}
-	isKnownScanner := false
-	for _, scanner := range knownScanners {
-		if strings.Contains(r.Spec.Image, scanner) {
-			isKnownScanner = true
-			break
-		}
-	}
-	if !isKnownScanner && r.Spec.Target != "" {
+	if scanner.DetectType(r.Spec.Image) == scanner.Unknown && r.Spec.Target != "" {
 		warnings = append(warnings, "Image doesn't appear to be a known security scanner (trivy, grype, kube-bench, kubesec)")
 	}
 
@@ -180,11 +308,10 @@ func (w *ClusterScanWebhook) validateClusterScan(r *scanv1alpha1.ClusterScan) (a
 func (w *ClusterScanWebhook) validateClusterScanUpdate(old, new *scanv1alpha1.ClusterScan) (admission.Warnings, error) {
 	var warnings admission.Warnings
 
-	if old.Status.Phase != "" && old.Status.Phase != PhasePending {
-		if old.Spec.Target != new.Spec.Target && old.Spec.Target != "" {
-			return warnings, fmt.Errorf("target is immutable after first scan completes (current: %s, attempted: %s). Delete and recreate to scan different target",
-				old.Spec.Target, new.Spec.Target)
-		}
+	if old.Status.Phase != "" && old.Status.Phase != PhasePending && old.Status.Phase != PhaseRunning &&
+		old.Spec.Target != new.Spec.Target && old.Spec.Target != "" {
+		warnings = append(warnings, fmt.Sprintf("Changing target from '%s' to '%s' - a new scan will run and earlier results stay in the history",
+			old.Spec.Target, new.Spec.Target))
 	}
 
 	if old.Status.Phase == PhasePending && old.Spec.Target != new.Spec.Target && old.Spec.Target != "" {
@@ -204,9 +331,9 @@ func (w *ClusterScanWebhook) validateClusterScanUpdate(old, new *scanv1alpha1.Cl
 		}
 	}
 
-	oldScannerType := detectScannerType(old.Spec.Image)
-	newScannerType := detectScannerType(new.Spec.Image)
-	if oldScannerType != newScannerType && oldScannerType != "unknown" {
+	oldScannerType := scanner.DetectType(old.Spec.Image)
+	newScannerType := scanner.DetectType(new.Spec.Image)
+	if oldScannerType != newScannerType && oldScannerType != scanner.Unknown {
 		warnings = append(warnings, fmt.Sprintf("Changing scanner type from %s to %s - results may be incompatible",
 			oldScannerType, newScannerType))
 	}
@@ -249,20 +376,17 @@ func validateImageReference(image string) error {
 	return nil
 }
 
-func detectScannerType(image string) string {
-	image = strings.ToLower(image)
-	switch {
-	case strings.Contains(image, "trivy"):
-		return "trivy"
-	case strings.Contains(image, "kube-bench"):
-		return "kube-bench"
-	case strings.Contains(image, "grype"):
-		return "grype"
-	case strings.Contains(image, "kubesec"):
-		return "kubesec"
-	default:
-		return "unknown"
+// oldClusterScan returns the ClusterScan being updated by the admission request in ctx, or nil
+func oldClusterScan(ctx context.Context) *scanv1alpha1.ClusterScan {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil || req.Operation != admissionv1.Update || len(req.OldObject.Raw) == 0 {
+		return nil
+	}
+	old := &scanv1alpha1.ClusterScan{}
+	if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+		return nil
 	}
+	return old
 }
 
 func equalCommands(a, b []string) bool {
@@ -1,11 +1,18 @@
 package v1alpha1
 
 import (
+	"encoding/json"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 var _ = Describe("ClusterScan Webhook", func() {
@@ -52,8 +59,37 @@ var _ = Describe("ClusterScan Webhook", func() {
 			err := defaulter.Default(ctx, obj)
 			Expect(err).ToNot(HaveOccurred())
 
-			By("checking that the default values are set")
-			Expect(obj.Spec.Command).To(Equal([]string{"trivy", "image", TestTargetImage}))
+			By("checking that the command is left to be built from the target")
+			Expect(obj.Spec.Command).To(BeEmpty())
+		})
+
+		It("Should drop a command defaulted from the previous target when the target changes", func() {
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = TestTargetImage
+			obj.Spec.Command = []string{"trivy", "image", "--format", "json", TestTargetImage}
+			raw, err := json.Marshal(obj)
+			Expect(err).NotTo(HaveOccurred())
+			updateCtx := admission.NewContextWithRequest(ctx, admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update, OldObject: runtime.RawExtension{Raw: raw}},
+			})
+
+			obj.Spec.Target = "nginx:1.27"
+			Expect(defaulter.Default(updateCtx, obj)).To(Succeed())
+			Expect(obj.Spec.Command).To(BeEmpty())
+
+			By("keeping commands that do not name the previous target")
+			obj.Spec.Command = []string{"trivy", "image", "--severity", "HIGH", TestTargetImage}
+			Expect(defaulter.Default(updateCtx, obj)).To(Succeed())
+			Expect(obj.Spec.Command).To(HaveLen(5))
+		})
+
+		It("Should default the kube-bench command for host access scans", func() {
+			By("simulating a kube-bench scan with host access")
+			obj.Spec.Image = "aquasec/kube-bench:v0.7.0"
+			obj.Spec.HostAccess = &scanv1alpha1.HostAccess{AllNodes: true}
+
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Command).To(Equal([]string{"kube-bench", "run", "--json"}))
 		})
 
 		It("Should NOT apply defaults when command is already specified", func() {
@@ -97,6 +133,15 @@ var _ = Describe("ClusterScan Webhook", func() {
 			By("checking that command remains empty")
 			Expect(obj.Spec.Command).To(BeEmpty())
 		})
+
+		It("Should default a Trivy command reading the discovered image for target selectors", func() {
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.TargetSelector = &scanv1alpha1.TargetSelector{Namespaces: []string{"default"}}
+
+			err := defaulter.Default(ctx, obj)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Spec.Command).To(Equal([]string{"trivy", "image", "--format", "json", "$(SCAN_TARGET)"}))
+		})
 	})
 
 	Context("When creating ClusterScan under Validating Webhook", func() {
@@ -130,6 +175,34 @@ var _ = Describe("ClusterScan Webhook", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("Should admit creation if a TargetSelector is specified", func() {
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.TargetSelector = &scanv1alpha1.TargetSelector{Namespaces: []string{"default"}}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("Should deny creation if both Target and TargetSelector are specified", func() {
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = TestTargetImage
+			obj.Spec.TargetSelector = &scanv1alpha1.TargetSelector{}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("mutually exclusive"))
+		})
+
+		It("Should deny creation of a scheduled TargetSelector scan", func() {
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Schedule = "0 2 * * *"
+			obj.Spec.TargetSelector = &scanv1alpha1.TargetSelector{}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("not supported with 'schedule'"))
+		})
+
 		It("Should admit creation if Command is specified", func() {
 			By("simulating a valid creation with custom command")
 			obj.Spec.Image = "aquasec/kube-bench:latest"
@@ -222,6 +295,137 @@ var _ = Describe("ClusterScan Webhook", func() {
 			Expect(warnings).To(ContainElement(ContainSubstring("doesn't appear to be a known security scanner")))
 		})
 
+		It("Should deny volume mounts without a matching volume", func() {
+			By("simulating a mount of an undeclared volume")
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = TestTargetImage
+			obj.Spec.VolumeMounts = []corev1.VolumeMount{{Name: "trivy-cache", MountPath: "/root/.cache"}}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not match any entry in 'volumes'"))
+
+			obj.Spec.Volumes = []corev1.Volume{{
+				Name:         "trivy-cache",
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("Should deny volumes using the name reserved for target credentials", func() {
+			By("simulating a volume named like the credentials volume")
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = "registry.example.com/team/app:1.0"
+			obj.Spec.TargetCredentials = &scanv1alpha1.TargetCredentials{SecretName: "registry"}
+			obj.Spec.Volumes = []corev1.Volume{{
+				Name:         "target-credentials",
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			}}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("reserved for 'targetCredentials'"))
+		})
+
+		It("Should deny a timeout shorter than a second", func() {
+			By("simulating a zero timeout")
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = "nginx:1.25"
+			obj.Spec.Timeout = &metav1.Duration{}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("'timeout' must be at least 1s"))
+
+			obj.Spec.Timeout = &metav1.Duration{Duration: 30 * time.Minute}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("Should deny exit codes mapped more than once", func() {
+			By("simulating the same exit code with two results")
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = "nginx:1.25"
+			obj.Spec.ExitCodes = []scanv1alpha1.ExitCodeRule{
+				{Code: 1, Result: scanv1alpha1.ResultFindingsDetected},
+				{Code: 1, Result: scanv1alpha1.ResultScannerError},
+			}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("exit code 1 is listed more than once"))
+		})
+
+		It("Should deny a results container that is neither the scanner nor a sidecar", func() {
+			By("simulating results read from a sidecar that does not exist")
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = "nginx:1.25"
+			obj.Spec.Sidecars = []corev1.Container{{Name: "uploader", Image: "busybox:1.36"}}
+			obj.Spec.ResultsContainer = "converter"
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("'resultsContainer' must be"))
+
+			By("reading results from the sidecar")
+			obj.Spec.ResultsContainer = "uploader"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).ToNot(HaveOccurred())
+
+			By("naming a sidecar like the scanner")
+			obj.Spec.Sidecars[0].Name = "scanner"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("already used"))
+		})
+
+		It("Should deny host access fan-out on a schedule", func() {
+			By("simulating a scheduled scan of every node")
+			obj.Spec.Image = "aquasec/kube-bench:v0.7.0"
+			obj.Spec.Command = []string{"kube-bench", "run", "--json"}
+			obj.Spec.Schedule = "0 3 * * *"
+			obj.Spec.HostAccess = &scanv1alpha1.HostAccess{AllNodes: true}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("not supported with 'schedule' yet"))
+		})
+
+		It("Should deny per-node scans combined with a target selector", func() {
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.TargetSelector = &scanv1alpha1.TargetSelector{Namespaces: []string{"default"}}
+			obj.Spec.PerNode = &scanv1alpha1.PerNode{}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot be combined with 'targetSelector'"))
+		})
+
+		It("Should deny host access for scanners other than kube-bench", func() {
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.Target = TestTargetImage
+			obj.Spec.HostAccess = &scanv1alpha1.HostAccess{}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("only supported for kube-bench"))
+
+			_, err = validator.ValidateUpdate(ctx, obj, obj)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should deny overriding SCAN_TARGET in selector scans", func() {
+			By("simulating a selector scan that sets SCAN_TARGET")
+			obj.Spec.Image = DefaultScannerImage
+			obj.Spec.TargetSelector = &scanv1alpha1.TargetSelector{Namespaces: []string{"default"}}
+			obj.Spec.Env = []corev1.EnvVar{{Name: "SCAN_TARGET", Value: "nginx:1.25"}}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot set SCAN_TARGET"))
+		})
+
 		It("Should warn about suspend without schedule", func() {
 			By("simulating suspend on one-time scan")
 			obj.Spec.Image = DefaultScannerImage
@@ -235,7 +439,7 @@ var _ = Describe("ClusterScan Webhook", func() {
 	})
 
 	Context("When updating ClusterScan under Validating Webhook", func() {
-		It("Should deny target change after scan completes", func() {
+		It("Should warn about target change after scan completes", func() {
 			By("simulating completed scan")
 			oldObj.Spec.Image = DefaultScannerImage
 			oldObj.Spec.Target = TestTargetImage
@@ -244,9 +448,9 @@ var _ = Describe("ClusterScan Webhook", func() {
 			obj.Spec.Image = DefaultScannerImage
 			obj.Spec.Target = "nginx:1.20"
 
-			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
-			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("target is immutable after first scan completes"))
+			warnings, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("a new scan will run")))
 		})
 
 		It("Should allow target change while still pending", func() {
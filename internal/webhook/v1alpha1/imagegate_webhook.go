@@ -0,0 +1,226 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+// Image gate modes
+const (
+	ImageGateOff     = "off"
+	ImageGateAudit   = "audit"
+	ImageGateEnforce = "enforce"
+)
+
+// scanNameLabel marks the operator's own scanner Pods, which are never gated
+const scanNameLabel = "scan.ahmali3.github.io/name"
+
+// reportImageField indexes ScanReports by the normalized reference and the digest of their target
+const reportImageField = "spec.targetImage"
+
+var imagegatelog = logf.Log.WithName("imagegate")
+
+// ImageGateConfig configures admission of Pods and Deployments based on ClusterScan results
+type ImageGateConfig struct {
+	// Mode is off, audit (admit with warnings) or enforce (reject)
+	Mode string
+
+	// ExemptNamespaces are never gated
+	ExemptNamespaces []string
+
+	// RequireScan treats images without any ScanReport as violations
+	RequireScan bool
+
+	// FailClosed rejects workloads when scan results cannot be looked up
+	FailClosed bool
+}
+
+// ImageGateWebhook checks the images of new Pods and Deployments against their latest
+// ScanReport, which records whether the scan's failure policy was violated
+type ImageGateWebhook struct {
+	Client client.Reader
+	Config ImageGateConfig
+}
+
+func (w *ImageGateWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &scanv1alpha1.ScanReport{}, reportImageField,
+		reportImages); err != nil {
+		return err
+	}
+	if err := ctrl.NewWebhookManagedBy(mgr).For(&corev1.Pod{}).WithValidator(w).Complete(); err != nil {
+		return err
+	}
+	return ctrl.NewWebhookManagedBy(mgr).For(&appsv1.Deployment{}).WithValidator(w).Complete()
+}
+
+// The webhook configuration is not generated from markers: config/webhook/imagegate.yaml is only
+// deployed with the gate enabled, and excludes kube-system and the operator's namespace.
+
+var _ webhook.CustomValidator = &ImageGateWebhook{}
+
+func (w *ImageGateWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return w.validate(ctx, obj)
+}
+
+func (w *ImageGateWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return w.validate(ctx, newObj)
+}
+
+func (w *ImageGateWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (w *ImageGateWebhook) validate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	if w.Config.Mode == "" || w.Config.Mode == ImageGateOff {
+		return nil, nil
+	}
+
+	var workload client.Object
+	var spec *corev1.PodSpec
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		workload, spec = o, &o.Spec
+	case *appsv1.Deployment:
+		workload, spec = o, &o.Spec.Template.Spec
+	default:
+		return nil, fmt.Errorf("expected a Pod or Deployment but got %T", obj)
+	}
+	if slices.Contains(w.Config.ExemptNamespaces, workload.GetNamespace()) || workload.GetLabels()[scanNameLabel] != "" {
+		return nil, nil
+	}
+
+	violations, err := w.imageViolations(ctx, spec)
+	if err != nil {
+		imagegatelog.Error(err, "Unable to look up scan results", "namespace", workload.GetNamespace(), "name", workload.GetName())
+		if w.Config.FailClosed {
+			return nil, fmt.Errorf("image gate could not look up scan results: %v", err)
+		}
+		return admission.Warnings{fmt.Sprintf("Image gate could not look up scan results: %v", err)}, nil
+	}
+	if len(violations) == 0 {
+		return nil, nil
+	}
+
+	imagegatelog.Info("Workload images violate scan policy", "namespace", workload.GetNamespace(),
+		"name", workload.GetName(), "mode", w.Config.Mode, "violations", violations)
+	if w.Config.Mode == ImageGateEnforce {
+		return nil, fmt.Errorf("image gate: %s", strings.Join(violations, "; "))
+	}
+	warnings := admission.Warnings{}
+	for _, violation := range violations {
+		warnings = append(warnings, "Image gate (audit): "+violation)
+	}
+	return warnings, nil
+}
+
+// imageViolations checks every container image against its latest ScanReport
+func (w *ImageGateWebhook) imageViolations(ctx context.Context, spec *corev1.PodSpec) ([]string, error) {
+	var violations []string
+	checked := map[string]bool{}
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		if checked[c.Image] {
+			continue
+		}
+		checked[c.Image] = true
+
+		report, err := w.latestReportFor(ctx, c.Image)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case report == nil && w.Config.RequireScan:
+			violations = append(violations, fmt.Sprintf("image %s has never been scanned", c.Image))
+		case report != nil && len(report.Spec.PolicyViolations) > 0:
+			violations = append(violations, fmt.Sprintf("image %s violates the failure policy of ClusterScan %s/%s (%s)",
+				c.Image, report.Namespace, report.Spec.ScanName, strings.Join(report.Spec.PolicyViolations, ", ")))
+		}
+	}
+	return violations, nil
+}
+
+// latestReportFor returns the most recently completed report that scanned image, matching
+// references in their normalized form and digest-pinned references by digest
+func (w *ImageGateWebhook) latestReportFor(ctx context.Context, image string) (*scanv1alpha1.ScanReport, error) {
+	keys := []string{normalizeImage(image)}
+	if _, digest, found := strings.Cut(image, "@"); found {
+		keys = append(keys, digest)
+	}
+
+	var latest *scanv1alpha1.ScanReport
+	for _, key := range keys {
+		reports := &scanv1alpha1.ScanReportList{}
+		if err := w.Client.List(ctx, reports, client.MatchingFields{reportImageField: key}); err != nil {
+			return nil, err
+		}
+		for i := range reports.Items {
+			report := &reports.Items[i]
+			if latest == nil || completedAfter(report, latest) {
+				latest = report
+			}
+		}
+	}
+	return latest, nil
+}
+
+// reportImages returns the index values of a ScanReport for reportImageField
+func reportImages(obj client.Object) []string {
+	report := obj.(*scanv1alpha1.ScanReport)
+	if report.Spec.Target == "" {
+		return nil
+	}
+	images := []string{normalizeImage(report.Spec.Target)}
+	if report.Spec.TargetDigest != "" {
+		images = append(images, report.Spec.TargetDigest)
+	}
+	return images
+}
+
+// normalizeImage returns the fully qualified form of an image reference, so that nginx and
+// docker.io/library/nginx:latest are equal. A digest replaces the tag.
+func normalizeImage(image string) string {
+	name, digest, _ := strings.Cut(image, "@")
+	tag := ""
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+
+	domain, path := "docker.io", name
+	if first, rest, found := strings.Cut(name, "/"); found &&
+		(strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first) {
+		domain, path = first, rest
+	}
+	if domain == "index.docker.io" {
+		domain = "docker.io"
+	}
+	if domain == "docker.io" && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+
+	if digest != "" {
+		return domain + "/" + path + "@" + digest
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+	return domain + "/" + path + ":" + tag
+}
+
+func completedAfter(a, b *scanv1alpha1.ScanReport) bool {
+	if a.Spec.CompletionTime == nil || b.Spec.CompletionTime == nil {
+		return b.Spec.CompletionTime == nil && a.Spec.CompletionTime != nil
+	}
+	return a.Spec.CompletionTime.After(b.Spec.CompletionTime.Time)
+}
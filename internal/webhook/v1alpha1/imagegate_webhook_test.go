@@ -0,0 +1,140 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	scanv1alpha1 "github.com/ahmali3/clusterscan-operator/api/v1alpha1"
+)
+
+var _ = Describe("Image gate Webhook", func() {
+	var gate *ImageGateWebhook
+
+	report := func(name, target string, age time.Duration, violations ...string) *scanv1alpha1.ScanReport {
+		completed := metav1.NewTime(time.Now().Add(-age))
+		return &scanv1alpha1.ScanReport{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "security"},
+			Spec: scanv1alpha1.ScanReportSpec{
+				ScanName: "images", JobName: name, Target: target,
+				CompletionTime: &completed, PolicyViolations: violations,
+			},
+		}
+	}
+
+	pod := func(namespace string, images ...string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace}}
+		for _, image := range images {
+			p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Name: "c", Image: image})
+		}
+		return p
+	}
+
+	BeforeEach(func() {
+		Expect(scanv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			report("nginx-old", "nginx:1.25", 2*time.Hour),
+			report("nginx-new", "nginx:1.25", time.Hour, "critical findings (2) exceed maxCritical (0)"),
+			report("redis", "redis:7", time.Hour),
+			report("busybox", "docker.io/library/busybox:latest", time.Hour, "critical findings (1) exceed maxCritical (0)"),
+		).WithIndex(&scanv1alpha1.ScanReport{}, reportImageField, reportImages).Build()
+		gate = &ImageGateWebhook{Client: c, Config: ImageGateConfig{Mode: ImageGateEnforce}}
+	})
+
+	It("Should reject images whose latest scan violated its failure policy", func() {
+		_, err := gate.ValidateCreate(ctx, pod("apps", "redis:7", "nginx:1.25"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("image nginx:1.25 violates the failure policy of ClusterScan security/images"))
+	})
+
+	It("Should admit images within policy and unscanned images unless a scan is required", func() {
+		_, err := gate.ValidateCreate(ctx, pod("apps", "redis:7", "alpine:3.20"))
+		Expect(err).ToNot(HaveOccurred())
+
+		gate.Config.RequireScan = true
+		_, err = gate.ValidateCreate(ctx, pod("apps", "alpine:3.20"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("has never been scanned"))
+	})
+
+	It("Should match references to the same image however they are written", func() {
+		_, err := gate.ValidateCreate(ctx, pod("apps", "busybox"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("image busybox violates"))
+		_, err = gate.ValidateCreate(ctx, pod("apps", "docker.io/library/nginx:1.25"))
+		Expect(err).To(HaveOccurred())
+		_, err = gate.ValidateCreate(ctx, pod("apps", "quay.io/library/nginx:1.25"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(normalizeImage("nginx")).To(Equal("docker.io/library/nginx:latest"))
+		Expect(normalizeImage("index.docker.io/bitnami/redis:7")).To(Equal("docker.io/bitnami/redis:7"))
+		Expect(normalizeImage("localhost:5000/app")).To(Equal("localhost:5000/app:latest"))
+		Expect(normalizeImage("ghcr.io/org/app:v1@sha256:abc")).To(Equal("ghcr.io/org/app@sha256:abc"))
+	})
+
+	It("Should match digest-pinned images by digest", func() {
+		pinned := report("app", "ghcr.io/org/app:v1", time.Hour, "critical findings (1) exceed maxCritical (0)")
+		pinned.Spec.TargetDigest = "sha256:abc"
+		Expect(gate.Client.(client.Client).Create(ctx, pinned)).To(Succeed())
+
+		_, err := gate.ValidateCreate(ctx, pod("apps", "ghcr.io/org/app@sha256:abc"))
+		Expect(err).To(HaveOccurred())
+		_, err = gate.ValidateCreate(ctx, pod("apps", "ghcr.io/org/app@sha256:def"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Should check the pod template of Deployments", func() {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"}}
+		deployment.Spec.Template.Spec = pod("apps", "nginx:1.25").Spec
+		_, err := gate.ValidateUpdate(ctx, deployment, deployment)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should only warn in audit mode", func() {
+		gate.Config.Mode = ImageGateAudit
+		warnings, err := gate.ValidateCreate(ctx, pod("apps", "nginx:1.25"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(warnings).To(ContainElement(ContainSubstring("Image gate (audit)")))
+	})
+
+	It("Should skip exempt namespaces, scanner pods and disabled gates", func() {
+		gate.Config.ExemptNamespaces = []string{"kube-system"}
+		_, err := gate.ValidateCreate(ctx, pod("kube-system", "nginx:1.25"))
+		Expect(err).ToNot(HaveOccurred())
+
+		scanner := pod("apps", "nginx:1.25")
+		scanner.Labels = map[string]string{scanNameLabel: "images"}
+		_, err = gate.ValidateCreate(ctx, scanner)
+		Expect(err).ToNot(HaveOccurred())
+
+		gate.Config.Mode = ImageGateOff
+		_, err = gate.ValidateCreate(ctx, pod("apps", "nginx:1.25"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Should fail open or closed when results cannot be looked up", func() {
+		gate.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+			List: func(_ context.Context, _ client.WithWatch, _ client.ObjectList, _ ...client.ListOption) error {
+				return fmt.Errorf("cache not synced")
+			},
+		}).Build()
+
+		warnings, err := gate.ValidateCreate(ctx, pod("apps", "nginx:1.25"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(warnings).To(ContainElement(ContainSubstring("could not look up scan results")))
+
+		gate.Config.FailClosed = true
+		_, err = gate.ValidateCreate(ctx, pod("apps", "nginx:1.25"))
+		Expect(err).To(HaveOccurred())
+	})
+})
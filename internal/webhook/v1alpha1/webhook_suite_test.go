@@ -112,6 +112,9 @@ var _ = BeforeSuite(func() {
 	err = (&ClusterScanWebhook{}).SetupWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = (&ImageGateWebhook{Client: mgr.GetClient()}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
 	// +kubebuilder:scaffold:webhook
 
 	go func() {
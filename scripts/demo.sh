@@ -221,8 +221,8 @@ demo_compliance_scanning() {
     run_command "kubectl get jobs | grep compliance-scan"
     
     echo ""
-    echo -e "${YELLOW}Note: Kube-bench checks control plane and node configurations${NC}"
-    echo -e "${YELLOW}Check results with: kubectl logs job/compliance-scan-job${NC}"
+    echo -e "${YELLOW}Note: Kube-bench runs once on every node and checks the components it finds there${NC}"
+    echo -e "${YELLOW}Per-node results: kubectl get clusterscan compliance-scan -o jsonpath='{.status.nodes}'${NC}"
     
     pause
 }